@@ -9,7 +9,6 @@ import (
 	"path/filepath"
 	"time"
 
-	"github.com/aws/smithy-go"
 	"github.com/fly-apps/fly-etcd/internal/flyetcd"
 )
 
@@ -18,7 +17,6 @@ const (
 )
 
 var (
-	s3Prefix  = os.Getenv("FLY_APP_NAME")
 	machineID = os.Getenv("FLY_MACHINE_ID")
 )
 
@@ -30,19 +28,19 @@ func runBackups(ctx context.Context) {
 		panic(err)
 	}
 
-	// Initialize etcd client
-	cli, err := flyetcd.NewClient(endpoints)
-	if err != nil {
+	// Initialize etcd client. It's rebuilt if the root password is rotated while we're running.
+	clients := flyetcd.NewCachedClient(endpoints)
+	if _, err := clients.Get(); err != nil {
 		log.Printf("[error] Failed to initialize etcd client: %v", err)
 		panic(err)
 	}
 	defer func() {
-		_ = cli.Client.Close()
+		_ = clients.Close()
 	}()
 
-	s3Client, err := flyetcd.NewS3Client(ctx, s3Prefix)
+	store, err := flyetcd.OpenBackupStore(ctx)
 	if err != nil {
-		log.Printf("[error] Failed to initialize S3 client: %v", err)
+		log.Printf("[error] Failed to initialize backup store: %v", err)
 		panic(err)
 	}
 
@@ -50,7 +48,7 @@ func runBackups(ctx context.Context) {
 	backupInterval := resolveBackupInterval()
 
 	// Determine if we should perform a backup now or wait
-	interval := maybeBackup(ctx, cli, s3Client, backupInterval)
+	interval := maybeBackup(ctx, clients, store, backupInterval)
 	if interval <= 0 {
 		interval = backupInterval
 	}
@@ -63,7 +61,7 @@ func runBackups(ctx context.Context) {
 			log.Printf("[warn] Shutting down")
 			return
 		case <-ticker.C:
-			interval = maybeBackup(ctx, cli, s3Client, backupInterval)
+			interval = maybeBackup(ctx, clients, store, backupInterval)
 			if interval <= 0 {
 				interval = backupInterval
 			}
@@ -72,19 +70,27 @@ func runBackups(ctx context.Context) {
 	}
 }
 
-func maybeBackup(ctx context.Context, cli *flyetcd.Client, s3Client *flyetcd.S3Client, backupInterval time.Duration) time.Duration {
+func maybeBackup(ctx context.Context, clients *flyetcd.CachedClient, store flyetcd.BackupStore, backupInterval time.Duration) time.Duration {
+	cli, err := clients.Get()
+	if err != nil {
+		log.Printf("[error] Failed to initialize etcd client: %v", err)
+		return backupInterval
+	}
+
 	isLeader, err := cli.IsLeader(ctx, machineID)
 	if err != nil {
+		clients.ResetOnAuthError(err)
 		log.Printf("[error] Failed to check leader status: %v", err)
 		return backupInterval
 	}
 
 	// Get last backup time
-	lastTime, err := s3Client.LastBackupTaken(ctx)
+	latest, err := store.Latest(ctx)
+	lastTime := latest.LastModified
 	if err != nil {
-		if isNotFoundErr(err) {
+		if errors.Is(err, flyetcd.ErrBackupNotFound) {
 			if isLeader {
-				doBackup(ctx, cli, s3Client)
+				doBackup(ctx, clients, store)
 				return backupInterval
 			}
 			// Schedule a re-check one minute from now. We will never boot as a leader, so provides
@@ -109,19 +115,22 @@ func maybeBackup(ctx context.Context, cli *flyetcd.Client, s3Client *flyetcd.S3C
 		return backupInterval
 	}
 
-	doBackup(ctx, cli, s3Client)
+	doBackup(ctx, clients, store)
 
 	return backupInterval
 }
 
-func isNotFoundErr(err error) bool {
-	var apiErr smithy.APIError
-	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "NotFound"
-}
+func doBackup(ctx context.Context, clients *flyetcd.CachedClient, store flyetcd.BackupStore) {
+	cli, err := clients.Get()
+	if err != nil {
+		log.Printf("[warn] Backup failed: %v", err)
+		backupSuccess.Set(0)
+		return
+	}
 
-func doBackup(ctx context.Context, cli *flyetcd.Client, s3Client *flyetcd.S3Client) {
 	log.Printf("[info] Performing backup...")
-	if err := performBackup(ctx, cli, s3Client); err != nil {
+	if err := performBackup(ctx, cli, store); err != nil {
+		clients.ResetOnAuthError(err)
 		log.Printf("[warn] Backup failed: %v", err)
 		backupSuccess.Set(0)
 	} else {
@@ -129,7 +138,7 @@ func doBackup(ctx context.Context, cli *flyetcd.Client, s3Client *flyetcd.S3Clie
 	}
 }
 
-func performBackup(parentCtx context.Context, cli *flyetcd.Client, s3Client *flyetcd.S3Client) error {
+func performBackup(parentCtx context.Context, cli *flyetcd.Client, store flyetcd.BackupStore) error {
 	startTime := time.Now()
 	defer func() {
 		backupDuration.Observe(time.Since(startTime).Seconds())
@@ -152,6 +161,11 @@ func performBackup(parentCtx context.Context, cli *flyetcd.Client, s3Client *fly
 	ctx, cancel := context.WithTimeout(parentCtx, 2*time.Minute)
 	defer cancel()
 
+	revision, err := cli.Revision(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to resolve revision: %w", err)
+	}
+
 	_, err = cli.Backup(ctx, backupPath)
 	if err != nil {
 		return fmt.Errorf("failed to create snapshot: %w", err)
@@ -163,16 +177,37 @@ func performBackup(parentCtx context.Context, cli *flyetcd.Client, s3Client *fly
 	}
 	backupSize.Set(float64(fi.Size()))
 
-	version, err := s3Client.Upload(ctx, backupPath)
+	version, err := flyetcd.UploadBackup(ctx, store, backupPath, revision)
 	if err != nil {
 		return fmt.Errorf("failed to upload backup: %w", err)
 	}
 
-	log.Printf("[info] Backup successful. Size: %0.2f MiB, Version: %s", float64(fi.Size())/(1024*1024), version)
+	log.Printf("[info] Backup successful. Location: %s, Size: %0.2f MiB, Version: %s", store.Location(), float64(fi.Size())/(1024*1024), version)
+
+	// A failed prune shouldn't fail the backup, it's retried after the next one. Pruning gets its
+	// own timeout, as a slow upload may have used up most of the backup's.
+	pruneCtx, pruneCancel := context.WithTimeout(parentCtx, 2*time.Minute)
+	defer pruneCancel()
+	pruneBackups(pruneCtx, store)
 
 	return nil
 }
 
+func pruneBackups(ctx context.Context, store flyetcd.BackupStore) {
+	policy := flyetcd.ResolveRetentionPolicy()
+	if !policy.Enabled() {
+		return
+	}
+
+	pruned, err := flyetcd.PruneBackups(ctx, store, policy, false)
+	for _, b := range pruned {
+		log.Printf("[info] Pruned backup %s from %s", b.VersionID, b.LastModified.Format(time.RFC3339))
+	}
+	if err != nil {
+		log.Printf("[warn] Failed to prune backups: %v", err)
+	}
+}
+
 func resolveBackupInterval() time.Duration {
 	customBackupInterval := os.Getenv("BACKUP_INTERVAL")
 	if customBackupInterval != "" {
@@ -123,24 +123,35 @@ func metricsHandler() http.Handler {
 			log.Printf("Error writing newline: %v", err)
 		}
 
-		// Then fetch and write etcd metrics
-		client := http.Client{
-			Timeout: 5 * time.Second,
-		}
-		resp, err := client.Get(flyetcd.MetricsEndpoint)
-		if err != nil {
-			log.Printf("Error scraping etcd metrics: %v", err)
-			scrapeErrors.Inc()
-			return
-		}
-		defer func() {
-			_ = resp.Body.Close()
-		}()
-
-		_, err = io.Copy(w, resp.Body)
-		if err != nil {
-			log.Printf("Error writing etcd metrics: %v", err)
-			scrapeErrors.Inc()
-		}
+		// Then fetch and write etcd's and the admin API's metrics
+		proxyMetrics(w, flyetcd.MetricsEndpoint)
+		proxyMetrics(w, flyetcd.AdminMetricsEndpoint)
 	})
 }
+
+func proxyMetrics(w io.Writer, endpoint string) {
+	client := http.Client{
+		Timeout: 5 * time.Second,
+	}
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		log.Printf("Error scraping metrics from %s: %v", endpoint, err)
+		scrapeErrors.Inc()
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Error scraping metrics from %s: %s", endpoint, resp.Status)
+		scrapeErrors.Inc()
+		return
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	if err != nil {
+		log.Printf("Error writing metrics from %s: %v", endpoint, err)
+		scrapeErrors.Inc()
+	}
+}
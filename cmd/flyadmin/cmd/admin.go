@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/fly-apps/fly-etcd/internal/flyetcd"
+)
+
+// postAdmin issues a request against this machine's admin API and decodes the response into out.
+func postAdmin(ctx context.Context, path string, out any) error {
+	return postAdminURL(ctx, flyetcd.NewEndpoint("").AdminURL+path, out)
+}
+
+// postAdminURL issues a request against the admin API at the specified URL and decodes the
+// response into out.
+func postAdminURL(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	flyetcd.AuthorizeAdminRequest(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s", strings.TrimSpace(string(body)))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
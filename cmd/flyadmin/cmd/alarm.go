@@ -35,6 +35,9 @@ var alarmDisarmCmd = &cobra.Command{
 			fmt.Println(err.Error())
 			return
 		}
+		defer func() {
+			_ = client.Close()
+		}()
 		ctx, cancel := context.WithTimeout(context.TODO(), (10 * time.Second))
 		resp, err := client.AlarmDisarm(ctx, &clientv3.AlarmMember{})
 		cancel()
@@ -56,6 +59,9 @@ var alarmListCmd = &cobra.Command{
 			fmt.Println(err.Error())
 			return
 		}
+		defer func() {
+			_ = client.Close()
+		}()
 		ctx, cancel := context.WithTimeout(context.TODO(), (10 * time.Second))
 		resp, err := client.AlarmList(ctx)
 		cancel()
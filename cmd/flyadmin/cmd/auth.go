@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/fly-apps/fly-etcd/internal/flyetcd"
+	"github.com/spf13/cobra"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	yaml "gopkg.in/yaml.v3"
+)
+
+func init() {
+	rootCmd.AddCommand(authCmd)
+	authCmd.AddCommand(authStatusCmd)
+	authCmd.AddCommand(authEnableCmd)
+	authCmd.AddCommand(authApplyCmd)
+	authCmd.AddCommand(authExportCmd)
+	authCmd.AddCommand(authRotateJWTCmd)
+	authCmd.AddCommand(authRotateRootCmd)
+
+	authApplyCmd.Flags().StringP("file", "f", "", "Path to the RBAC config file")
+	authApplyCmd.Flags().Bool("dry-run", false, "Print the plan without applying it")
+	_ = authApplyCmd.MarkFlagRequired("file")
+
+	authRotateRootCmd.Flags().String("password", "", "New root password, defaults to ETCD_ROOT_PASSWORD_NEXT or a generated one. Passing it here leaves it in your shell history")
+}
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Manage Etcd authentication",
+	Long:  `Manage Etcd authentication`,
+}
+
+var authStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the authentication status",
+	Long:  "Shows whether authentication is enabled and whether the root user matches ETCD_ROOT_PASSWORD",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			// Logging in as root is rejected outright when the password doesn't match.
+			if errors.Is(err, rpctypes.ErrAuthFailed) {
+				fmt.Println("Auth enabled:  true")
+				fmt.Println("Root password: does not match ETCD_ROOT_PASSWORD")
+				return
+			}
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), (10 * time.Second))
+		state, err := client.AuthState(ctx)
+		cancel()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		fmt.Printf("Auth enabled:  %t\n", state.Enabled)
+		switch {
+		case !state.RootConfigured:
+			fmt.Println("Root password: ETCD_ROOT_PASSWORD is not set")
+		case !state.Enabled:
+			fmt.Println("Root password: not verified, auth is disabled")
+		case state.RootValid:
+			fmt.Printf("Root password: matches %s\n", state.RootSecret)
+		default:
+			fmt.Printf("Root password: does not match ETCD_ROOT_PASSWORD (%v)\n", state.RootErr)
+		}
+	},
+}
+
+var authEnableCmd = &cobra.Command{
+	Use:   "enable",
+	Short: "Enable authentication",
+	Long:  "Creates the root user from ETCD_ROOT_PASSWORD and enables authentication. Clusters enable it automatically when they're first formed, this is for clusters created before the password was set.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !flyetcd.RootPasswordConfigured() {
+			fmt.Println("ETCD_ROOT_PASSWORD is not set")
+			return
+		}
+
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), (30 * time.Second))
+		err = client.EnableAuth(ctx, os.Getenv("ETCD_ROOT_PASSWORD"))
+		cancel()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		fmt.Println("Authentication enabled.")
+	},
+}
+
+var authApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Reconcile users and roles with an RBAC config file",
+	Long:  "Prints the changes required to match the users, roles and permissions in the RBAC config file, then applies them. The root user and role are left untouched.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		path, err := cmd.Flags().GetString("file")
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		desired, err := flyetcd.ReadRBACConfig(path)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), (60 * time.Second))
+		defer cancel()
+
+		current, err := client.RBACConfig(ctx)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		changes := flyetcd.PlanRBAC(current, desired)
+		if len(changes) == 0 {
+			fmt.Println("No changes required")
+			return
+		}
+
+		fmt.Println("Plan:")
+		for _, change := range changes {
+			fmt.Printf("  %s\n", change)
+		}
+
+		if dryRun {
+			return
+		}
+
+		if err := client.ApplyRBAC(ctx, changes); err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		fmt.Printf("Applied %d change(s)\n", len(changes))
+	},
+}
+
+var authExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export users and roles as an RBAC config file",
+	Long:  "Prints the current users, roles and permissions in the format accepted by `flyadmin auth apply`. Passwords are not exported.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), (30 * time.Second))
+		cfg, err := client.RBACConfig(ctx)
+		cancel()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		data, err := yaml.Marshal(cfg)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		fmt.Print(string(data))
+	},
+}
+
+var authRotateJWTCmd = &cobra.Command{
+	Use:   "rotate-jwt",
+	Short: "Move every member over to the staged JWT key pair",
+	Long:  "Restarts each member, one at a time, with the key pair staged in ETCD_JWT_PRIVATE_NEXT and ETCD_JWT_PUBLIC_NEXT. Etcd verifies tokens against a single public key, so there is no overlap window: tokens issued with one key pair are rejected by members on the other until every member has been moved over, so clients must authenticate again and in-flight requests may fail.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := flyetcd.ValidateNextJWTKeys(); err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		endpoints, err := flyetcd.AllEndpoints(cmd.Context())
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].Name < endpoints[j].Name })
+
+		for _, endpoint := range endpoints {
+			fmt.Printf("Rotating %s... ", endpoint.Name)
+			ctx, cancel := context.WithTimeout(cmd.Context(), (11 * time.Minute))
+			var result map[string]string
+			err := postAdminURL(ctx, endpoint.AdminURL+"/auth/jwt/rotate", &result)
+			cancel()
+			if err != nil {
+				fmt.Println("failed")
+				fmt.Printf("Rotation stopped, resolve the issue and run the command again: %s\n", err)
+				return
+			}
+			fmt.Println("done")
+		}
+
+		fmt.Println("Every member now signs tokens with the staged key pair. Promote it with:")
+		if method := os.Getenv("ETCD_JWT_SIGN_METHOD_NEXT"); method != "" {
+			fmt.Printf("  fly secrets set ETCD_JWT_PRIVATE=<next private key> ETCD_JWT_PUBLIC=<next public key> ETCD_JWT_SIGN_METHOD=%s\n", method)
+		} else {
+			fmt.Println("  fly secrets set ETCD_JWT_PRIVATE=<next private key> ETCD_JWT_PUBLIC=<next public key>")
+		}
+		fmt.Println("  fly secrets unset ETCD_JWT_PRIVATE_NEXT ETCD_JWT_PUBLIC_NEXT ETCD_JWT_SIGN_METHOD_NEXT")
+	},
+}
+
+var authRotateRootCmd = &cobra.Command{
+	Use:   "rotate-root",
+	Short: "Rotate the root password",
+	Long:  "Changes the root password and verifies every member accepts it. Stage the new password in ETCD_ROOT_PASSWORD_NEXT first. Running processes log in again with the staged password once the old one is rejected, so at most one of their requests fails during the rotation.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		password, err := cmd.Flags().GetString("password")
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		staged := os.Getenv("ETCD_ROOT_PASSWORD_NEXT")
+		if password == "" {
+			password = staged
+		}
+		if password == "" {
+			password, err = flyetcd.GenerateRootPassword()
+			if err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+		}
+
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), (60 * time.Second))
+		err = client.RotateRootPassword(ctx, password)
+		cancel()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		fmt.Println("Root password rotated and verified against every member. Apply it with:")
+		fmt.Printf("  fly secrets set ETCD_ROOT_PASSWORD=%s\n", password)
+		if staged != "" {
+			fmt.Println("  fly secrets unset ETCD_ROOT_PASSWORD_NEXT")
+		}
+		if staged != password {
+			fmt.Println("The new password was not staged in ETCD_ROOT_PASSWORD_NEXT, so processes will fail to authenticate until the secret is updated.")
+		}
+	},
+}
@@ -1,16 +1,19 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"path"
+	"strings"
 	"time"
 
 	humanize "github.com/dustin/go-humanize"
 	"github.com/fly-apps/fly-etcd/internal/flyetcd"
 	"github.com/olekukonko/tablewriter"
 	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
 )
 
 func init() {
@@ -18,8 +21,12 @@ func init() {
 	backupsCmd.AddCommand(backupsListCmd)
 	backupsCmd.AddCommand(backupCreateCmd)
 	backupsCmd.AddCommand(backupRestoreCmd)
+	backupsCmd.AddCommand(backupDeleteCmd)
+	backupsCmd.AddCommand(backupPruneCmd)
 
+	backupsListCmd.Flags().Bool("keys", false, "Look up the key each backup was encrypted with, which takes a request per backup on S3")
 	backupCreateCmd.Flags().Bool("force", false, "Force backup creation even if it's not a leader")
+	backupPruneCmd.Flags().Bool("dry-run", false, "Show which backups would be deleted without deleting them")
 }
 
 var backupsCmd = &cobra.Command{
@@ -40,28 +47,37 @@ var backupsListCmd = &cobra.Command{
 			return
 		}
 
-		flyAppName := os.Getenv("FLY_APP_NAME")
+		store, err := flyetcd.OpenBackupStore(cmd.Context())
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
 
-		s3Client, err := flyetcd.NewS3Client(cmd.Context(), flyAppName)
+		keys, err := cmd.Flags().GetBool("keys")
 		if err != nil {
 			fmt.Println(err.Error())
 			return
 		}
 
-		versions, err := s3Client.ListBackups(cmd.Context())
+		versions, err := store.List(cmd.Context())
 		if err != nil {
 			fmt.Println(err.Error())
 			return
 		}
 
+		if keys {
+			resolveBackupKeyIDs(cmd.Context(), store, versions)
+		}
+
 		rows := [][]string{}
-		hdr := []string{"ID", "Last Modified", "Size", "Latest"}
+		hdr := []string{"ID", "Last Modified", "Size", "Latest", "Key ID"}
 		for _, version := range versions {
 			rows = append(rows, []string{
 				version.VersionID,
 				version.LastModified.Format(time.RFC3339),
 				humanize.Bytes(uint64(version.Size)),
 				fmt.Sprint(version.IsLatest),
+				version.KeyID,
 			})
 		}
 
@@ -102,6 +118,9 @@ var backupCreateCmd = &cobra.Command{
 			fmt.Println(err.Error())
 			return
 		}
+		defer func() {
+			_ = etcdClient.Close()
+		}()
 
 		isLeader, err := etcdClient.IsLeader(cmd.Context(), machineID)
 		if err != nil {
@@ -114,8 +133,7 @@ var backupCreateCmd = &cobra.Command{
 			return
 		}
 
-		flyAppName := os.Getenv("FLY_APP_NAME")
-		s3Client, err := flyetcd.NewS3Client(cmd.Context(), flyAppName)
+		store, err := flyetcd.OpenBackupStore(cmd.Context())
 		if err != nil {
 			fmt.Println(err.Error())
 			return
@@ -135,6 +153,12 @@ var backupCreateCmd = &cobra.Command{
 		fileName := fmt.Sprintf("backup-%s.db", time.Now().Format("20060102-150405"))
 		backupPath := path.Join(tmpDir, fileName)
 
+		revision, err := etcdClient.Revision(cmd.Context())
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
 		// Create a new backup
 		size, err := etcdClient.Backup(cmd.Context(), backupPath)
 		if err != nil {
@@ -144,14 +168,14 @@ var backupCreateCmd = &cobra.Command{
 
 		fmt.Printf("Backup created: %s (%s)\n", backupPath, humanize.Bytes(uint64(size)))
 
-		// Upload to S3
-		version, err := s3Client.Upload(cmd.Context(), backupPath)
+		// Upload to the backup store
+		version, err := flyetcd.UploadBackup(cmd.Context(), store, backupPath, revision)
 		if err != nil {
 			fmt.Println(err.Error())
 			return
 		}
 
-		fmt.Println("Backup uploaded to S3 as version:", version)
+		fmt.Printf("Backup uploaded to %s as version: %s\n", store.Location(), version)
 	},
 }
 
@@ -168,14 +192,23 @@ var backupRestoreCmd = &cobra.Command{
 
 		version := args[0]
 
-		flyAppName := os.Getenv("FLY_APP_NAME")
+		store, err := flyetcd.OpenBackupStore(cmd.Context())
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
 
-		s3Client, err := flyetcd.NewS3Client(cmd.Context(), flyAppName)
+		meta, err := store.Metadata(cmd.Context(), version)
 		if err != nil {
 			fmt.Println(err.Error())
 			return
 		}
 
+		fmt.Printf("Restoring backup %s taken %s (%s)\n", version, meta.LastModified.Format(time.RFC3339), humanize.Bytes(uint64(meta.Size)))
+		if meta.KeyID != "" {
+			fmt.Printf("Backup is encrypted with key %s\n", meta.KeyID)
+		}
+
 		tmpDir, err := os.MkdirTemp("", "etcd-restore-*")
 		if err != nil {
 			fmt.Println(err.Error())
@@ -187,8 +220,8 @@ var backupRestoreCmd = &cobra.Command{
 			}
 		}()
 
-		// Download backup from S3
-		pathToSnap, err := s3Client.Download(cmd.Context(), tmpDir, version)
+		// Download and verify the backup
+		pathToSnap, err := flyetcd.FetchBackup(cmd.Context(), store, tmpDir, version)
 		if err != nil {
 			fmt.Println(err.Error())
 			return
@@ -201,6 +234,9 @@ var backupRestoreCmd = &cobra.Command{
 			fmt.Println(err.Error())
 			return
 		}
+		defer func() {
+			_ = client.Close()
+		}()
 
 		if err := client.Restore(cmd.Context(), pathToSnap); err != nil {
 			fmt.Println(err.Error())
@@ -210,7 +246,97 @@ var backupRestoreCmd = &cobra.Command{
 	},
 }
 
+var backupDeleteCmd = &cobra.Command{
+	Use:   "delete <version>",
+	Short: "Delete a backup",
+	Long:  "Delete a backup from the backup store",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if !backupsEnabled() {
+			fmt.Println("Backups are not enabled")
+			return
+		}
+
+		store, err := flyetcd.OpenBackupStore(cmd.Context())
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		if err := store.Delete(cmd.Context(), args[0]); err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		fmt.Printf("Backup %s deleted\n", args[0])
+	},
+}
+
+var backupPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Prune backups outside the retention policy",
+	Long:  "Delete backups that aren't retained by the BACKUP_RETAIN_HOURLY, BACKUP_RETAIN_DAILY and BACKUP_RETAIN_WEEKLY policy",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !backupsEnabled() {
+			fmt.Println("Backups are not enabled")
+			return
+		}
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		policy := flyetcd.ResolveRetentionPolicy()
+		if !policy.Enabled() {
+			fmt.Println("No retention policy is configured")
+			return
+		}
+
+		store, err := flyetcd.OpenBackupStore(cmd.Context())
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		pruned, pruneErr := flyetcd.PruneBackups(cmd.Context(), store, policy, dryRun)
+		if len(pruned) == 0 && pruneErr == nil {
+			fmt.Printf("Nothing to prune (retaining %s)\n", policy)
+			return
+		}
+
+		if dryRun {
+			fmt.Printf("The following backups would be deleted from %s (retaining %s):\n", store.Location(), policy)
+		} else {
+			fmt.Printf("Deleted the following backups from %s (retaining %s):\n", store.Location(), policy)
+		}
+
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader([]string{"ID", "Last Modified", "Size"})
+		for _, b := range pruned {
+			table.Append([]string{
+				b.VersionID,
+				b.LastModified.Format(time.RFC3339),
+				humanize.Bytes(uint64(b.Size)),
+			})
+		}
+		table.SetAlignment(tablewriter.ALIGN_RIGHT)
+		table.Render()
+
+		if pruneErr != nil {
+			fmt.Println(pruneErr.Error())
+		}
+	},
+}
+
 func backupsEnabled() bool {
+	// A non-S3 backup store is configured
+	if u := os.Getenv("BACKUP_URL"); u != "" && !strings.HasPrefix(u, "s3://") {
+		return true
+	}
+
 	// OIDC is enabled
 	if os.Getenv("AWS_REGION") != "" && os.Getenv("AWS_ROLE_ARN") != "" {
 		return true
@@ -221,5 +347,32 @@ func backupsEnabled() bool {
 		return true
 	}
 
+	// Static credentials are set for an S3-compatible endpoint, which doesn't need a region
+	if os.Getenv("AWS_ACCESS_KEY_ID") != "" && os.Getenv("AWS_SECRET_ACCESS_KEY") != "" && os.Getenv("S3_ENDPOINT") != "" {
+		return true
+	}
+
 	return false
 }
+
+// resolveBackupKeyIDs looks up the key of each backup the listing didn't include it for. Backups
+// that can't be looked up are marked as unknown rather than failing the listing.
+func resolveBackupKeyIDs(ctx context.Context, store flyetcd.BackupStore, versions []flyetcd.BackupVersion) {
+	var g errgroup.Group
+	g.SetLimit(8)
+	for i := range versions {
+		if versions[i].KeyID != "" {
+			continue
+		}
+		g.Go(func() error {
+			meta, err := store.Metadata(ctx, versions[i].VersionID)
+			if err != nil {
+				versions[i].KeyID = "unknown"
+				return nil
+			}
+			versions[i].KeyID = meta.KeyID
+			return nil
+		})
+	}
+	_ = g.Wait()
+}
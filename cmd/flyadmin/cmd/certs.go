@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fly-apps/fly-etcd/internal/flyetcd"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(certsCmd)
+	certsCmd.AddCommand(certsIssueCmd)
+	certsCmd.AddCommand(certsRotateCmd)
+	certsIssueCmd.Flags().Duration("validity", 90*24*time.Hour, "How long the certificate is valid for")
+}
+
+var certsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "Manage TLS certificates",
+	Long:  `Manage certificates issued from the cluster CA`,
+}
+
+var certsIssueCmd = &cobra.Command{
+	Use:   "issue <common-name>",
+	Short: "Issue a client certificate",
+	Long:  "Issues a client certificate from the cluster CA and prints it, followed by its private key. When auth is enabled, Etcd authenticates the certificate as the user matching the common name.",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		validity, err := cmd.Flags().GetDuration("validity")
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		certPEM, keyPEM, err := flyetcd.IssueClientCertificate(args[0], validity)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		_, _ = os.Stdout.Write(certPEM)
+		_, _ = os.Stdout.Write(keyPEM)
+	},
+}
+
+var certsRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Rotate this member's certificates",
+	Long:  "Reissues this member's peer and client certificates and restarts Etcd to load them. Members restart one at a time.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(cmd.Context(), (11 * time.Minute))
+		defer cancel()
+
+		var certs []flyetcd.CertificateInfo
+		if err := postAdmin(ctx, "/certs/rotate", &certs); err != nil {
+			fmt.Printf("Failed to rotate certificates: %s\n", err)
+			return
+		}
+
+		fmt.Println("Certificates rotated and Etcd restarted.")
+		for _, cert := range certs {
+			fmt.Printf("%s valid until %s\n", cert.Source, cert.NotAfter.Format(time.RFC3339))
+		}
+	},
+}
@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/fly-apps/fly-etcd/internal/flyetcd"
 	"github.com/spf13/cobra"
@@ -11,6 +13,38 @@ import (
 func init() {
 	rootCmd.AddCommand(forceNewClusterCmd)
 	rootCmd.AddCommand(resetForceNewClusterFlagCmd)
+	rootCmd.AddCommand(clusterIdentityCmd)
+}
+
+var clusterIdentityCmd = &cobra.Command{
+	Use:   "identity",
+	Short: "Show the cluster identity",
+	Long:  "Shows the identity published by the cluster. Set ETCD_CLUSTER_ID to pin new members to this cluster.",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+		ctx, cancel := context.WithTimeout(cmd.Context(), (10 * time.Second))
+		identity, err := client.ClusterIdentity(ctx)
+		cancel()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		if identity == nil {
+			fmt.Println("Cluster identity has not been published")
+			return
+		}
+		fmt.Printf("Cluster ID: %s\n", identity.ClusterID)
+		fmt.Printf("Token:      %s\n", identity.Token)
+		fmt.Printf("App:        %s\n", identity.AppName)
+		fmt.Printf("Created:    %s\n", identity.CreatedAt.Format(time.RFC3339))
+	},
 }
 
 var forceNewClusterCmd = &cobra.Command{
@@ -43,6 +43,9 @@ var endpointStatusCmd = &cobra.Command{
 			fmt.Println(err.Error())
 			return
 		}
+		defer func() {
+			_ = client.Close()
+		}()
 		useDNS, err := cmd.Flags().GetBool("dns")
 		if err != nil {
 			fmt.Println(err.Error())
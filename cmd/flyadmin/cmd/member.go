@@ -18,6 +18,8 @@ func init() {
 	rootCmd.AddCommand(membersCmd)
 	membersCmd.AddCommand(membersListCmd)
 	membersCmd.AddCommand(memberRemoveCmd)
+	membersCmd.AddCommand(memberLeaveCmd)
+	membersCmd.AddCommand(memberMigratePeerTLSCmd)
 }
 
 var membersCmd = &cobra.Command{
@@ -37,6 +39,9 @@ var memberRemoveCmd = &cobra.Command{
 			fmt.Println(err.Error())
 			return
 		}
+		defer func() {
+			_ = client.Close()
+		}()
 		id := args[0]
 		i64, err := strconv.ParseUint(id, 16, 64)
 		if err != nil {
@@ -53,6 +58,49 @@ var memberRemoveCmd = &cobra.Command{
 	},
 }
 
+var memberLeaveCmd = &cobra.Command{
+	Use:   "leave",
+	Short: "Remove this machine from the cluster",
+	Long:  "Transfers leadership if held, removes this member from the cluster, stops Etcd and marks the volume as decommissioned",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(cmd.Context(), (60 * time.Second))
+		defer cancel()
+
+		var result flyetcd.LeaveResult
+		if err := postAdmin(ctx, "/member/leave", &result); err != nil {
+			fmt.Printf("Failed to leave the cluster: %s\n", err)
+			return
+		}
+
+		if result.NewLeader != 0 {
+			fmt.Printf("Leadership transferred to %x\n", result.NewLeader)
+		}
+		fmt.Printf("Member %x has left the cluster and Etcd has been stopped.\n", result.MemberID)
+		fmt.Printf("Destroy this machine to complete the scale-down: fly machine destroy %s\n", os.Getenv("FLY_MACHINE_ID"))
+	},
+}
+
+var memberMigratePeerTLSCmd = &cobra.Command{
+	Use:   "migrate-peer-tls",
+	Short: "Switch this member's peer URLs to https",
+	Long:  "Updates this member's peer URLs to https and restarts Etcd to serve peers over TLS. Run on one member at a time.",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		ctx, cancel := context.WithTimeout(cmd.Context(), (60 * time.Second))
+		defer cancel()
+
+		var result flyetcd.PeerMigrationResult
+		if err := postAdmin(ctx, "/member/migrate-peer-tls", &result); err != nil {
+			fmt.Printf("Failed to migrate peer URLs: %s\n", err)
+			return
+		}
+
+		fmt.Printf("Member %x now advertises %s and Etcd is restarting.\n", result.MemberID, result.PeerURL)
+		fmt.Println("Verify the cluster is healthy with `flyadmin endpoint status` before migrating the next member.")
+	},
+}
+
 var membersListCmd = &cobra.Command{
 	Use:   "list",
 	Short: "List all members",
@@ -63,6 +111,9 @@ var membersListCmd = &cobra.Command{
 			fmt.Println(err.Error())
 			return
 		}
+		defer func() {
+			_ = client.Close()
+		}()
 		ctx, cancel := context.WithTimeout(cmd.Context(), (10 * time.Second))
 		resp, err := client.MemberList(ctx)
 		cancel()
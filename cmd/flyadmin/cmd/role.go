@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fly-apps/fly-etcd/internal/flyetcd"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(roleCmd)
+	roleCmd.AddCommand(roleListCmd)
+	roleCmd.AddCommand(roleAddCmd)
+	roleCmd.AddCommand(roleDeleteCmd)
+	roleCmd.AddCommand(roleGrantPermissionCmd)
+	roleCmd.AddCommand(roleRevokePermissionCmd)
+
+	for _, cmd := range []*cobra.Command{roleGrantPermissionCmd, roleRevokePermissionCmd} {
+		cmd.Flags().Bool("prefix", false, "Apply to every key with the specified prefix")
+		cmd.Flags().String("range-end", "", "Apply to the range of keys [key, range-end)")
+	}
+}
+
+var roleCmd = &cobra.Command{
+	Use:   "role",
+	Short: "Manage Etcd roles",
+	Long:  `Manage Etcd roles`,
+}
+
+var roleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all roles",
+	Long:  "Lists all roles along with their permissions",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+		ctx, cancel := context.WithTimeout(cmd.Context(), (10 * time.Second))
+		roles, err := client.Roles(ctx)
+		cancel()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		printRolesTable(roles)
+	},
+}
+
+var roleAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Add a role",
+	Long:  "Adds a new role",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+		ctx, cancel := context.WithTimeout(cmd.Context(), (10 * time.Second))
+		_, err = client.RoleAdd(ctx, args[0])
+		cancel()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		fmt.Printf("Role %s added\n", args[0])
+	},
+}
+
+var roleDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a role",
+	Long:  "Deletes a role",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+		ctx, cancel := context.WithTimeout(cmd.Context(), (10 * time.Second))
+		_, err = client.RoleDelete(ctx, args[0])
+		cancel()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		fmt.Printf("Role %s deleted\n", args[0])
+	},
+}
+
+var roleGrantPermissionCmd = &cobra.Command{
+	Use:   "grant-permission <name> <read|write|readwrite> <key>",
+	Short: "Grant a permission to a role",
+	Long:  "Grants a role access to a key, a key prefix or a range of keys",
+	Args:  cobra.ExactArgs(3),
+	Run: func(cmd *cobra.Command, args []string) {
+		perm, err := permissionFromArgs(cmd, args[1], args[2])
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		permType, err := flyetcd.ParsePermissionType(perm.Type)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+		key, rangeEnd := perm.KeyRange()
+		ctx, cancel := context.WithTimeout(cmd.Context(), (10 * time.Second))
+		_, err = client.RoleGrantPermission(ctx, args[0], key, rangeEnd, permType)
+		cancel()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		fmt.Printf("Permission %s granted to %s\n", describePermission(perm), args[0])
+	},
+}
+
+var roleRevokePermissionCmd = &cobra.Command{
+	Use:   "revoke-permission <name> <key>",
+	Short: "Revoke a permission from a role",
+	Long:  "Revokes a role's access to a key, a key prefix or a range of keys",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		perm, err := permissionFromArgs(cmd, "", args[1])
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+		key, rangeEnd := perm.KeyRange()
+		ctx, cancel := context.WithTimeout(cmd.Context(), (10 * time.Second))
+		_, err = client.RoleRevokePermission(ctx, args[0], key, rangeEnd)
+		cancel()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		fmt.Printf("Permission on %s revoked from %s\n", describePermission(perm), args[0])
+	},
+}
+
+func permissionFromArgs(cmd *cobra.Command, permType, key string) (flyetcd.Permission, error) {
+	prefix, err := cmd.Flags().GetBool("prefix")
+	if err != nil {
+		return flyetcd.Permission{}, err
+	}
+	rangeEnd, err := cmd.Flags().GetString("range-end")
+	if err != nil {
+		return flyetcd.Permission{}, err
+	}
+	if prefix && rangeEnd != "" {
+		return flyetcd.Permission{}, fmt.Errorf("--prefix and --range-end are mutually exclusive")
+	}
+	return flyetcd.Permission{Type: permType, Key: key, Prefix: prefix, RangeEnd: rangeEnd}, nil
+}
+
+func describePermission(perm flyetcd.Permission) string {
+	var desc string
+	switch {
+	case perm.Prefix:
+		desc = fmt.Sprintf("prefix %q", perm.Key)
+	case perm.RangeEnd != "":
+		desc = fmt.Sprintf("range [%q, %q)", perm.Key, perm.RangeEnd)
+	default:
+		desc = fmt.Sprintf("key %q", perm.Key)
+	}
+	if perm.Type != "" {
+		desc = fmt.Sprintf("%s on %s", perm.Type, desc)
+	}
+	return desc
+}
+
+func printRolesTable(roles []flyetcd.Role) {
+	hdr, rows := makeRoleListTable(roles)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(hdr)
+	for _, row := range rows {
+		table.Append(row)
+	}
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	table.Render()
+}
+
+func makeRoleListTable(roles []flyetcd.Role) (hdr []string, rows [][]string) {
+	hdr = []string{"Role", "Type", "Key", "Range End", "Prefix"}
+	for _, r := range roles {
+		if len(r.Permissions) == 0 {
+			rows = append(rows, []string{r.Name, "", "", "", ""})
+			continue
+		}
+		for _, p := range r.Permissions {
+			prefix := "false"
+			if p.Prefix {
+				prefix = "true"
+			}
+			rows = append(rows, []string{r.Name, p.Type, p.Key, p.RangeEnd, prefix})
+		}
+	}
+	return hdr, rows
+}
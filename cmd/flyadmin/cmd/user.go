@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fly-apps/fly-etcd/internal/flyetcd"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"golang.org/x/term"
+)
+
+func init() {
+	rootCmd.AddCommand(userCmd)
+	userCmd.AddCommand(userListCmd)
+	userCmd.AddCommand(userAddCmd)
+	userCmd.AddCommand(userDeleteCmd)
+	userCmd.AddCommand(userPasswdCmd)
+	userCmd.AddCommand(userGrantRoleCmd)
+	userCmd.AddCommand(userRevokeRoleCmd)
+
+	userAddCmd.Flags().String("password", "", "Password for the user, prompted for when not specified. Passing it here leaves it in your shell history")
+	userAddCmd.Flags().Bool("no-password", false, "Create a user that can only authenticate with a client certificate")
+	userPasswdCmd.Flags().String("password", "", "New password for the user, prompted for when not specified. Passing it here leaves it in your shell history")
+}
+
+var userCmd = &cobra.Command{
+	Use:   "user",
+	Short: "Manage Etcd users",
+	Long:  `Manage Etcd users`,
+}
+
+var userListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all users",
+	Long:  "Lists all users along with their roles",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+		ctx, cancel := context.WithTimeout(cmd.Context(), (10 * time.Second))
+		users, err := client.Users(ctx)
+		cancel()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		printUsersTable(users)
+	},
+}
+
+var userAddCmd = &cobra.Command{
+	Use:   "add <name>",
+	Short: "Add a user",
+	Long:  "Adds a new user",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		noPassword, err := cmd.Flags().GetBool("no-password")
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		var password string
+		if !noPassword {
+			password, err = readPassword(cmd)
+			if err != nil {
+				fmt.Println(err.Error())
+				return
+			}
+		}
+
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+		ctx, cancel := context.WithTimeout(cmd.Context(), (10 * time.Second))
+		_, err = client.UserAddWithOptions(ctx, args[0], password, &clientv3.UserAddOptions{NoPassword: noPassword})
+		cancel()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		fmt.Printf("User %s added\n", args[0])
+	},
+}
+
+var userDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a user",
+	Long:  "Deletes a user",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+		ctx, cancel := context.WithTimeout(cmd.Context(), (10 * time.Second))
+		_, err = client.UserDelete(ctx, args[0])
+		cancel()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		fmt.Printf("User %s deleted\n", args[0])
+	},
+}
+
+var userPasswdCmd = &cobra.Command{
+	Use:   "passwd <name>",
+	Short: "Change a user's password",
+	Long:  "Changes a user's password",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		password, err := readPassword(cmd)
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+		ctx, cancel := context.WithTimeout(cmd.Context(), (10 * time.Second))
+		_, err = client.UserChangePassword(ctx, args[0], password)
+		cancel()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		fmt.Printf("Password updated for %s\n", args[0])
+	},
+}
+
+var userGrantRoleCmd = &cobra.Command{
+	Use:   "grant-role <name> <role>",
+	Short: "Grant a role to a user",
+	Long:  "Grants a role to a user",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+		ctx, cancel := context.WithTimeout(cmd.Context(), (10 * time.Second))
+		_, err = client.UserGrantRole(ctx, args[0], args[1])
+		cancel()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		fmt.Printf("Role %s granted to %s\n", args[1], args[0])
+	},
+}
+
+var userRevokeRoleCmd = &cobra.Command{
+	Use:   "revoke-role <name> <role>",
+	Short: "Revoke a role from a user",
+	Long:  "Revokes a role from a user",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		defer func() {
+			_ = client.Close()
+		}()
+		ctx, cancel := context.WithTimeout(cmd.Context(), (10 * time.Second))
+		_, err = client.UserRevokeRole(ctx, args[0], args[1])
+		cancel()
+		if err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+
+		fmt.Printf("Role %s revoked from %s\n", args[1], args[0])
+	},
+}
+
+// readPassword returns the password specified with --password, or reads it from stdin. When
+// stdin is a terminal, the password isn't echoed.
+func readPassword(cmd *cobra.Command) (string, error) {
+	password, err := cmd.Flags().GetString("password")
+	if err != nil {
+		return "", err
+	}
+	if password != "" {
+		return password, nil
+	}
+
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Print("Password: ")
+		b, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		password = string(b)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("failed to read password: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	if password == "" {
+		return "", fmt.Errorf("password must not be empty")
+	}
+	return password, nil
+}
+
+func printUsersTable(users []flyetcd.User) {
+	hdr, rows := makeUserListTable(users)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(hdr)
+	for _, row := range rows {
+		table.Append(row)
+	}
+	table.SetAlignment(tablewriter.ALIGN_RIGHT)
+	table.Render()
+}
+
+func makeUserListTable(users []flyetcd.User) (hdr []string, rows [][]string) {
+	hdr = []string{"Name", "Roles"}
+	for _, u := range users {
+		rows = append(rows, []string{
+			u.Name,
+			strings.Join(u.Roles, ","),
+		})
+	}
+	return hdr, rows
+}
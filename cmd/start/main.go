@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 	"syscall"
 	"time"
 
@@ -33,11 +34,23 @@ func main() {
 		panicHandler(fmt.Errorf("volume must be mounted at /data: %w", err))
 	}
 
+	// A member that has left the cluster must not rejoin with its stale data.
+	if flyetcd.Decommissioned() {
+		panicHandler(fmt.Errorf("this member has left the cluster and its volume is decommissioned, destroy the machine to complete the scale-down"))
+	}
+
 	log.Println("Waiting for network to come up.")
 	if err := waitForNetwork(ctx, node); err != nil {
 		panicHandler(err)
 	}
 
+	if err := node.Config.SetPeerTLS(node.Endpoint); err != nil {
+		panicHandler(err)
+	}
+	if err := node.Config.SetClientTLS(node.Endpoint); err != nil {
+		panicHandler(err)
+	}
+
 	if flyetcd.ConfigFilePresent() {
 		if err := node.Config.SetAuthToken(); err != nil {
 			panicHandler(err)
@@ -50,6 +63,17 @@ func main() {
 			panicHandler(err)
 		}
 	}
+	go recordClusterIdentity(ctx, node)
+	if flyetcd.RootPasswordConfigured() {
+		pending, err := flyetcd.AuthSetupPending()
+		if err != nil {
+			panicHandler(err)
+		}
+		if pending {
+			go enableAuth(ctx)
+		}
+	}
+
 	svisor := supervisor.New("fly-etcd", 5*time.Minute)
 	svisor.AddProcess("fly-etcd", fmt.Sprintf("etcd --config-file %s", flyetcd.ConfigFilePath))
 	svisor.AddProcess("admin", "/usr/local/bin/start-api",
@@ -63,7 +87,12 @@ func main() {
 	} else {
 		log.Println("[WARN] Backups are not configured!")
 	}
+	svisor.BeforeStop(func() {
+		handoffLeadership(node)
+	})
 	svisor.StopOnSignal(syscall.SIGINT, syscall.SIGTERM)
+	svisor.StopProcessOnSignal("fly-etcd", flyetcd.EtcdStopSignal)
+	svisor.RestartProcessOnSignal("fly-etcd", flyetcd.EtcdRestartSignal)
 
 	if err := svisor.Run(); err != nil {
 		panicHandler(err)
@@ -71,6 +100,11 @@ func main() {
 }
 
 func backupsEnabled() bool {
+	// A non-S3 backup store is configured
+	if u := os.Getenv("BACKUP_URL"); u != "" && !strings.HasPrefix(u, "s3://") {
+		return true
+	}
+
 	// OIDC is enabled
 	if os.Getenv("AWS_REGION") != "" && os.Getenv("AWS_ROLE_ARN") != "" {
 		return true
@@ -81,9 +115,94 @@ func backupsEnabled() bool {
 		return true
 	}
 
+	// Static credentials are set for an S3-compatible endpoint, which doesn't need a region
+	if os.Getenv("AWS_ACCESS_KEY_ID") != "" && os.Getenv("AWS_SECRET_ACCESS_KEY") != "" && os.Getenv("S3_ENDPOINT") != "" {
+		return true
+	}
+
 	return false
 }
 
+// whenEtcdReady waits for etcd to come up and runs fn against it, retrying until it succeeds.
+func whenEtcdReady(ctx context.Context, description string, fn func(context.Context, *flyetcd.Client) error) {
+	timeout := time.After(5 * time.Minute)
+	tick := time.NewTicker(5 * time.Second)
+	defer tick.Stop()
+
+	var lastErr error
+	for {
+		select {
+		case <-timeout:
+			log.Printf("[warn] Timed out waiting to %s: %v", description, lastErr)
+			return
+		case <-tick.C:
+		}
+
+		client, err := flyetcd.NewClient([]string{})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		rCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		lastErr = fn(rCtx, client)
+		cancel()
+		_ = client.Close()
+		if lastErr == nil {
+			return
+		}
+	}
+}
+
+// recordClusterIdentity records the identity of the cluster this member belongs to.
+func recordClusterIdentity(ctx context.Context, node *flyetcd.Node) {
+	whenEtcdReady(ctx, "record cluster identity", func(ctx context.Context, client *flyetcd.Client) error {
+		identity, err := node.RecordClusterIdentity(ctx, client)
+		if err != nil {
+			return err
+		}
+		log.Printf("Member of cluster %s", identity.ClusterID)
+		return nil
+	})
+}
+
+// enableAuth creates the root user from ETCD_ROOT_PASSWORD and enables authentication on the
+// cluster this machine formed.
+func enableAuth(ctx context.Context) {
+	whenEtcdReady(ctx, "enable auth", func(ctx context.Context, client *flyetcd.Client) error {
+		if err := client.EnableAuth(ctx, os.Getenv("ETCD_ROOT_PASSWORD")); err != nil {
+			return err
+		}
+		return flyetcd.RecordAuthEnabled()
+	})
+}
+
+// handoffLeadership moves leadership to the healthiest follower when this member is the
+// leader, so stopping etcd doesn't force an election.
+func handoffLeadership(node *flyetcd.Node) {
+	ctx, cancel := context.WithTimeout(context.Background(), flyetcd.LeaderHandoffTimeout())
+	defer cancel()
+
+	client, err := flyetcd.NewClient([]string{})
+	if err != nil {
+		log.Printf("[warn] Failed to initialize etcd client for leadership handoff: %v", err)
+		return
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	newLeader, err := client.TransferLeadership(ctx, node.MachineID)
+	if err != nil {
+		log.Printf("[warn] Failed to hand off leadership: %v", err)
+		return
+	}
+
+	if newLeader != 0 {
+		log.Printf("Leadership handed off to %x", newLeader)
+	}
+}
+
 // waitForNetwork waits for the internal network to become accessible.
 func waitForNetwork(ctx context.Context, node *flyetcd.Node) error {
 	timeout := time.After(5 * time.Minute)
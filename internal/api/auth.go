@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/fly-apps/fly-etcd/internal/flyetcd"
+)
+
+// handleJWTRotate moves this member over to the staged JWT key pair and restarts etcd.
+func handleJWTRotate(w http.ResponseWriter, r *http.Request) {
+	if err := flyetcd.ValidateNextJWTKeys(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	_, err := restartEtcd(r.Context(), func(node *flyetcd.Node) error {
+		if err := node.Config.ApplyNextJWTKeys(); err != nil {
+			return err
+		}
+		return flyetcd.WriteConfig(node.Config)
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"machine_id": os.Getenv("FLY_MACHINE_ID")})
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/fly-apps/fly-etcd/internal/flyetcd"
+)
+
+const certCheckInterval = 1 * time.Hour
+
+// runCertWatcher reissues this machine's certificates before they expire.
+func runCertWatcher(ctx context.Context) {
+	ticker := time.NewTicker(certCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		node, err := flyetcd.NewNode()
+		if err != nil {
+			log.Printf("[warn] failed to initialize node for certificate check: %v", err)
+			continue
+		}
+
+		due, err := node.Config.RenewalDue(time.Now(), flyetcd.CertRenewBefore())
+		if err != nil {
+			log.Printf("[warn] failed to check certificate expiry: %v", err)
+			continue
+		}
+		if !due {
+			continue
+		}
+
+		log.Printf("[info] Certificates expire within %s, rotating", flyetcd.CertRenewBefore())
+		if _, err := rotateCertificates(ctx); err != nil {
+			log.Printf("[error] failed to rotate certificates: %v", err)
+		}
+	}
+}
+
+// rotateCertificates reissues this machine's certificates and restarts etcd to load them.
+func rotateCertificates(ctx context.Context) ([]flyetcd.CertificateInfo, error) {
+	node, err := restartEtcd(ctx, func(node *flyetcd.Node) error {
+		if err := node.ReissueCertificates(); err != nil {
+			return fmt.Errorf("failed to reissue certificates: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return node.Config.LocalCertificates()
+}
+
+// handleCertsRotate reissues this machine's certificates regardless of their expiry.
+func handleCertsRotate(w http.ResponseWriter, r *http.Request) {
+	if !flyetcd.PeerTLSEnabled() && !flyetcd.ClientTLSEnabled() {
+		writeError(w, http.StatusBadRequest, errors.New("TLS is not enabled"))
+		return
+	}
+
+	certs, err := rotateCertificates(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, certs)
+}
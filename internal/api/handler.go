@@ -1,13 +1,20 @@
 package api
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"syscall"
 	"time"
 
 	"github.com/fly-apps/fly-etcd/internal/flycheck"
+	"github.com/fly-apps/fly-etcd/internal/flyetcd"
 	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const port = 5500
@@ -15,8 +22,37 @@ const port = 5500
 func StartHttpServer() error {
 	log.SetFlags(0)
 
+	promoter := newLearnerPromoter(os.Getenv("FLY_MACHINE_ID"))
+	go promoter.run(context.Background())
+
+	if flyetcd.ReaperEnabled() {
+		go runReaper(context.Background())
+	}
+
+	if flyetcd.PeerTLSEnabled() || flyetcd.ClientTLSEnabled() {
+		go runCertWatcher(context.Background())
+	}
+
 	r := chi.NewMux()
+
+	// Health checks are run by the platform, so they're left open. Metrics are only published
+	// through the etcd-backup metrics proxy.
 	r.Mount("/flycheck", flycheck.Handler())
+	r.With(localOnly).Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	r.Group(func(r chi.Router) {
+		r.Use(authenticate)
+		r.Get("/learner", promoter.handler)
+		r.Get("/preflight/dial", handlePreflightDial)
+		r.Post("/member/leave", handleMemberLeave)
+		r.Post("/member/migrate-peer-tls", handleMigratePeerTLS)
+		r.Post("/certs/rotate", handleCertsRotate)
+		r.Post("/auth/jwt/rotate", handleJWTRotate)
+	})
+
+	if !flyetcd.AdminAuthEnabled() {
+		log.Printf("[warn] ETCD_ADMIN_TOKEN is not set, admin API management requests are refused")
+	}
 
 	server := &http.Server{
 		Handler:           r,
@@ -26,3 +62,67 @@ func StartHttpServer() error {
 
 	return server.ListenAndServe()
 }
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to encode response: %s", err)
+	}
+}
+
+var errUnauthorized = errors.New("unauthorized")
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	http.Error(w, err.Error(), status)
+}
+
+// signalSupervisor sends the signal to the supervisor, which is our parent process.
+func signalSupervisor(sig syscall.Signal) error {
+	return syscall.Kill(os.Getppid(), sig)
+}
+
+// restartTimeout bounds how long a restart may wait for other members to finish theirs.
+const restartTimeout = 10 * time.Minute
+
+// restartEtcd runs prepare and restarts etcd to load the changes. The restart lock is held until
+// the member is healthy again, so members restart one at a time.
+func restartEtcd(ctx context.Context, prepare func(*flyetcd.Node) error) (*flyetcd.Node, error) {
+	ctx, cancel := context.WithTimeout(ctx, restartTimeout)
+	defer cancel()
+
+	node, err := flyetcd.NewNode()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := flyetcd.NewClient([]string{})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	unlock, err := client.Lock(ctx, flyetcd.RestartLockKey)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err := prepare(node); err != nil {
+		return nil, err
+	}
+
+	if err := signalSupervisor(flyetcd.EtcdRestartSignal); err != nil {
+		return nil, fmt.Errorf("failed to restart etcd: %w", err)
+	}
+
+	// Give etcd a moment to go down before waiting for it to come back.
+	time.Sleep(2 * time.Second)
+	if err := client.WaitForEndpoint(ctx, node.Endpoint.ClientURL); err != nil {
+		return nil, err
+	}
+
+	return node, nil
+}
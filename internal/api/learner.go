@@ -0,0 +1,141 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fly-apps/fly-etcd/internal/flyetcd"
+)
+
+const learnerCheckInterval = 10 * time.Second
+
+// learnerPromoter watches this machine's membership and promotes it to a voting member
+// once it has caught up with the leader.
+type learnerPromoter struct {
+	machineID string
+	threshold uint64
+
+	mu       sync.RWMutex
+	progress *flyetcd.LearnerProgress
+	lastErr  error
+}
+
+func newLearnerPromoter(machineID string) *learnerPromoter {
+	return &learnerPromoter{
+		machineID: machineID,
+		threshold: flyetcd.LearnerPromotionThreshold(),
+	}
+}
+
+func (p *learnerPromoter) run(ctx context.Context) {
+	clients := flyetcd.NewCachedClient([]string{})
+	defer func() {
+		_ = clients.Close()
+	}()
+
+	ticker := time.NewTicker(learnerCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		if p.reconcile(ctx, clients) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reconcile evaluates the learner's progress and promotes it once caught up. Returns true
+// once this machine is a voting member, or its member has been removed.
+func (p *learnerPromoter) reconcile(ctx context.Context, clients *flyetcd.CachedClient) bool {
+	// Etcd may still be starting, so the client is created lazily.
+	client, err := clients.Get()
+	if err != nil {
+		p.setError(err)
+		log.Printf("[warn] failed to initialize etcd client: %v", err)
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, (10 * time.Second))
+	defer cancel()
+
+	progress, err := client.LearnerProgress(ctx, p.machineID, p.threshold)
+	if err != nil {
+		// The member isn't registered until this machine has joined, but once it has been seen,
+		// its disappearance means it was removed from the cluster and there's nothing to promote.
+		var notFound *flyetcd.MemberNotFoundError
+		if errors.As(err, &notFound) && p.progress != nil {
+			p.setError(err)
+			log.Printf("[warn] member for machine %s was removed, no longer watching for promotion", p.machineID)
+			return true
+		}
+		clients.ResetOnAuthError(err)
+		p.setError(err)
+		log.Printf("[warn] failed to evaluate learner progress: %v", err)
+		return false
+	}
+	p.setProgress(progress)
+
+	if !progress.IsLearner {
+		return true
+	}
+
+	log.Printf("[info] learner %x applied index %d/%d (gap: %d, threshold: %d)",
+		progress.MemberID, progress.AppliedIndex, progress.LeaderAppliedIndex, progress.Gap, progress.Threshold)
+
+	if !progress.CaughtUp {
+		return false
+	}
+
+	if _, err := client.MemberPromote(ctx, progress.MemberID); err != nil {
+		clients.ResetOnAuthError(err)
+		p.setError(err)
+		log.Printf("[warn] failed to promote learner %x: %v", progress.MemberID, err)
+		return false
+	}
+
+	log.Printf("[info] learner %x promoted to voting member", progress.MemberID)
+	// The published progress may be read by the handler, so it's replaced rather than modified.
+	promoted := *progress
+	promoted.IsLearner = false
+	p.setProgress(&promoted)
+
+	return true
+}
+
+func (p *learnerPromoter) setProgress(progress *flyetcd.LearnerProgress) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress = progress
+	p.lastErr = nil
+}
+
+func (p *learnerPromoter) setError(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastErr = err
+}
+
+type learnerResponse struct {
+	Progress *flyetcd.LearnerProgress `json:"progress"`
+	Error    string                   `json:"error,omitempty"`
+}
+
+func (p *learnerPromoter) handler(w http.ResponseWriter, _ *http.Request) {
+	p.mu.RLock()
+	resp := learnerResponse{Progress: p.progress}
+	if p.lastErr != nil {
+		resp.Error = p.lastErr.Error()
+	}
+	p.mu.RUnlock()
+
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/fly-apps/fly-etcd/internal/flyetcd"
+)
+
+// handleMemberLeave gracefully removes this machine from the cluster and stops etcd.
+func handleMemberLeave(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), (30 * time.Second))
+	defer cancel()
+
+	node, err := flyetcd.NewNode()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	client, err := flyetcd.NewClient([]string{})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	result, err := node.Leave(ctx, client)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := signalSupervisor(flyetcd.EtcdStopSignal); err != nil {
+		log.Printf("[warn] failed to signal supervisor to stop etcd: %v", err)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleMigratePeerTLS switches this member's peer URLs over to https and restarts etcd, so
+// it starts serving peers over TLS. Nothing is changed if any step fails.
+func handleMigratePeerTLS(w http.ResponseWriter, r *http.Request) {
+	if !flyetcd.PeerTLSEnabled() {
+		writeError(w, http.StatusBadRequest, errors.New("peer TLS is not enabled"))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), (30 * time.Second))
+	defer cancel()
+
+	node, err := flyetcd.NewNode()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if node.Config.PeerTransportSecurity.CertFile == "" {
+		writeError(w, http.StatusConflict, errors.New("no peer certificate has been issued, restart the machine first"))
+		return
+	}
+
+	client, err := flyetcd.NewClient([]string{})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	result, err := node.MigratePeerTLS(ctx, client, func() error {
+		return signalSupervisor(flyetcd.EtcdRestartSignal)
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
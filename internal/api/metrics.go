@@ -0,0 +1,38 @@
+package api
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// registry only holds the admin API's own metrics, which are scraped over loopback by the
+	// etcd-backup metrics proxy alongside its own and etcd's.
+	registry = prometheus.NewRegistry()
+
+	reaperDecisions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "reaper",
+		Name:      "decisions_total",
+		Help:      "Number of decisions made about members whose machine is gone, by action",
+	}, []string{"action"})
+
+	reaperPendingMembers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "etcd",
+		Subsystem: "reaper",
+		Name:      "pending_members",
+		Help:      "Number of members whose machine is gone that are within the grace period",
+	})
+
+	reaperErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "etcd",
+		Subsystem: "reaper",
+		Name:      "errors_total",
+		Help:      "Number of reconciliation passes that failed",
+	})
+)
+
+func init() {
+	registry.MustRegister(reaperDecisions)
+	registry.MustRegister(reaperPendingMembers)
+	registry.MustRegister(reaperErrors)
+}
@@ -0,0 +1,59 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/fly-apps/fly-etcd/internal/flyetcd"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// authenticate rejects requests that don't present the admin token. Every call that gets
+// through is recorded in the audit log.
+func authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, ok := requestPrincipal(r)
+		if !ok {
+			log.Printf("[audit] rejected method=%s path=%s remote=%s", r.Method, r.URL.Path, r.RemoteAddr)
+			writeError(w, http.StatusUnauthorized, errUnauthorized)
+			return
+		}
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		log.Printf("[audit] principal=%s method=%s path=%s remote=%s status=%d duration=%s",
+			principal, r.Method, r.URL.RequestURI(), r.RemoteAddr, ww.Status(), time.Since(start))
+	})
+}
+
+// requestPrincipal identifies the caller. When admin authentication hasn't been configured,
+// read-only requests used while joining are let through as anonymous, but management
+// requests are refused.
+func requestPrincipal(r *http.Request) (string, bool) {
+	if !flyetcd.AdminAuthEnabled() {
+		return "anonymous", r.Method == http.MethodGet
+	}
+
+	if flyetcd.CheckAdminToken(r.Header.Get("Authorization")) {
+		return "token", true
+	}
+
+	return "", false
+}
+
+// localOnly restricts a route to requests made over loopback.
+func localOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			writeError(w, http.StatusForbidden, errors.New("only served over loopback"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/fly-apps/fly-etcd/internal/flyetcd"
+)
+
+// handlePreflightDial confirms this machine can reach a machine that is preparing to join.
+func handlePreflightDial(w http.ResponseWriter, r *http.Request) {
+	addr := r.URL.Query().Get("addr")
+	if err := flyetcd.ValidateHandshakeAddr(addr, os.Getenv("FLY_APP_NAME")); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var resp flyetcd.HandshakeResponse
+	if err := flyetcd.Dial(r.Context(), addr); err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Reachable = true
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
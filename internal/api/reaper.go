@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/fly-apps/fly-etcd/internal/flyetcd"
+)
+
+const reaperInterval = 1 * time.Minute
+
+// runReaper periodically removes members whose machine is gone. Only the leader reconciles,
+// so members are never removed concurrently from multiple machines.
+func runReaper(ctx context.Context) {
+	reaper := flyetcd.NewReaper()
+	machineID := os.Getenv("FLY_MACHINE_ID")
+
+	log.Printf("[info] Member reaper enabled with a grace period of %s", reaper.GracePeriod)
+
+	clients := flyetcd.NewCachedClient([]string{})
+	defer func() {
+		_ = clients.Close()
+	}()
+
+	ticker := time.NewTicker(reaperInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		client, err := clients.Get()
+		if err != nil {
+			log.Printf("[warn] reaper failed to initialize etcd client: %v", err)
+			reaperErrors.Inc()
+			continue
+		}
+
+		if err := reap(ctx, client, reaper, machineID); err != nil {
+			clients.ResetOnAuthError(err)
+		}
+	}
+}
+
+func reap(ctx context.Context, client *flyetcd.Client, reaper *flyetcd.Reaper, machineID string) error {
+	ctx, cancel := context.WithTimeout(ctx, (30 * time.Second))
+	defer cancel()
+
+	isLeader, err := client.IsLeader(ctx, machineID)
+	if err != nil {
+		log.Printf("[warn] reaper failed to check leader status: %v", err)
+		reaperErrors.Inc()
+		return err
+	}
+	if !isLeader {
+		reaperPendingMembers.Set(0)
+		return nil
+	}
+
+	decisions, err := reaper.Reconcile(ctx, client)
+	if err != nil {
+		log.Printf("[warn] reaper failed to reconcile members: %v", err)
+		reaperErrors.Inc()
+		return err
+	}
+
+	pending := 0
+	for _, decision := range decisions {
+		reaperDecisions.WithLabelValues(string(decision.Action)).Inc()
+		if decision.Action == flyetcd.ReapActionPending {
+			pending++
+		}
+		log.Printf("[info] reaper: %s", decision)
+	}
+	reaperPendingMembers.Set(float64(pending))
+	return nil
+}
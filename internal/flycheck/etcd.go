@@ -29,6 +29,12 @@ func checkEtcd(ctx context.Context, checks *check.CheckSuite) (*check.CheckSuite
 		return checkConnectivity(ctx, client)
 	})
 
+	if flyetcd.PeerTLSEnabled() || flyetcd.ClientTLSEnabled() {
+		checks.AddCheck("etcd-certificates", func() (string, error) {
+			return checkCertificates(ctx, client)
+		})
+	}
+
 	return checks, nil
 }
 
@@ -61,3 +67,34 @@ func checkConnectivity(ctx context.Context, client *flyetcd.Client) (string, err
 	}
 	return fmt.Sprintf("healthy: true, took: %v", time.Since(start)), nil
 }
+
+func checkCertificates(ctx context.Context, client *flyetcd.Client) (string, error) {
+	certs, err := client.MemberCertificates(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// Listeners that can't be reached are reported, but only expiring certificates fail the check.
+	var unreachable []string
+	for _, cert := range certs {
+		if cert.Error != "" {
+			unreachable = append(unreachable, fmt.Sprintf("%s could not be inspected: %s", cert.Source, cert.Error))
+		}
+	}
+
+	within := flyetcd.CertExpiryWarnBefore()
+	expiring := flyetcd.ExpiringCertificates(certs, time.Now(), within)
+	if len(expiring) > 0 {
+		var msgs []string
+		for _, cert := range expiring {
+			msgs = append(msgs, fmt.Sprintf("%s expires %s", cert.Source, cert.NotAfter.Format(time.RFC3339)))
+		}
+		return "", fmt.Errorf("%d of %d certificate(s) expire within %s: %s", len(expiring), len(certs), within, strings.Join(msgs, ", "))
+	}
+
+	if len(unreachable) > 0 {
+		return fmt.Sprintf("%d certificate(s) valid for at least %s, warning: %s",
+			len(certs)-len(unreachable), within, strings.Join(unreachable, ", ")), nil
+	}
+	return fmt.Sprintf("%d certificate(s) valid for at least %s", len(certs), within), nil
+}
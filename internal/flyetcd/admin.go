@@ -0,0 +1,29 @@
+package flyetcd
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// AdminAuthEnabled returns true if admin API requests must be authenticated.
+func AdminAuthEnabled() bool {
+	return os.Getenv("ETCD_ADMIN_TOKEN") != ""
+}
+
+// CheckAdminToken reports whether the Authorization header carries the admin token.
+func CheckAdminToken(header string) bool {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || !AdminAuthEnabled() {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(os.Getenv("ETCD_ADMIN_TOKEN"))) == 1
+}
+
+// AuthorizeAdminRequest attaches the admin token to a request bound for another machine's admin API.
+func AuthorizeAdminRequest(req *http.Request) {
+	if token := os.Getenv("ETCD_ADMIN_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+}
@@ -0,0 +1,41 @@
+package flyetcd
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCheckAdminToken(t *testing.T) {
+	t.Run("not configured", func(t *testing.T) {
+		t.Setenv("ETCD_ADMIN_TOKEN", "")
+		if CheckAdminToken("Bearer ") {
+			t.Error("expected an empty token to be rejected when none is configured")
+		}
+	})
+
+	t.Setenv("ETCD_ADMIN_TOKEN", "s3cret")
+
+	tests := map[string]bool{
+		"Bearer s3cret": true,
+		"Bearer wrong":  false,
+		"s3cret":        false,
+		"Basic s3cret":  false,
+		"":              false,
+	}
+	for header, expected := range tests {
+		if got := CheckAdminToken(header); got != expected {
+			t.Errorf("CheckAdminToken(%q): expected %t, got %t", header, expected, got)
+		}
+	}
+
+	t.Run("requests are authorized with the token", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:5500/member/leave", nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		AuthorizeAdminRequest(req)
+		if !CheckAdminToken(req.Header.Get("Authorization")) {
+			t.Errorf("expected authorized request to pass, got header %q", req.Header.Get("Authorization"))
+		}
+	})
+}
@@ -0,0 +1,182 @@
+package flyetcd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	client "go.etcd.io/etcd/client/v3"
+)
+
+// RootPasswordConfigured returns true if the root password has been provided.
+func RootPasswordConfigured() bool {
+	return os.Getenv("ETCD_ROOT_PASSWORD") != ""
+}
+
+// AuthSetupPending reports whether this machine formed the cluster and has yet to enable
+// authentication on it. Members joining an existing cluster leave its auth state alone, so
+// auth that was deliberately disabled isn't turned back on by a reboot.
+func AuthSetupPending() (bool, error) {
+	journal, err := readBootstrapJournal()
+	if err != nil {
+		return false, err
+	}
+	return journal.Founder && !journal.AuthEnabled, nil
+}
+
+// RecordAuthEnabled notes in the bootstrap journal that auth has been enabled, so it isn't
+// attempted again on the next boot.
+func RecordAuthEnabled() error {
+	journal, err := readBootstrapJournal()
+	if err != nil {
+		return err
+	}
+	journal.AuthEnabled = true
+	return journal.save()
+}
+
+// EnableAuth creates the root user and role with the specified password and enables
+// authentication. It's safe to call repeatedly and from multiple members at once.
+func (c *Client) EnableAuth(ctx context.Context, password string) error {
+	return enableAuth(ctx, c.Auth, password)
+}
+
+func enableAuth(ctx context.Context, c client.Auth, password string) error {
+	status, err := c.AuthStatus(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get auth status: %w", err)
+	}
+	if status.Enabled {
+		return nil
+	}
+
+	if _, err := c.RoleAdd(ctx, rootName); err != nil && !errors.Is(err, rpctypes.ErrRoleAlreadyExist) {
+		return fmt.Errorf("failed to create root role: %w", err)
+	}
+
+	if _, err := c.UserAdd(ctx, rootName, password); err != nil {
+		if !errors.Is(err, rpctypes.ErrUserAlreadyExist) {
+			return fmt.Errorf("failed to create root user: %w", err)
+		}
+		// The root user is left over from an earlier attempt, make sure it matches the secret.
+		if _, err := c.UserChangePassword(ctx, rootName, password); err != nil {
+			return fmt.Errorf("failed to update root password: %w", err)
+		}
+	}
+
+	if _, err := c.UserGrantRole(ctx, rootName, rootName); err != nil {
+		return fmt.Errorf("failed to grant root role: %w", err)
+	}
+
+	if _, err := c.AuthEnable(ctx); err != nil {
+		return fmt.Errorf("failed to enable auth: %w", err)
+	}
+
+	return nil
+}
+
+// AuthState describes whether authentication is enabled and whether the configured root
+// password is accepted.
+type AuthState struct {
+	Enabled        bool
+	RootConfigured bool
+	// RootValid is only meaningful when auth is enabled, as credentials aren't checked otherwise.
+	RootValid bool
+	RootErr   error
+	// RootSecret names the secret holding the password that was accepted.
+	RootSecret string
+}
+
+// AuthState reports the cluster's authentication state.
+func (c *Client) AuthState(ctx context.Context) (*AuthState, error) {
+	return authState(ctx, c.Auth)
+}
+
+func authState(ctx context.Context, c client.Auth) (*AuthState, error) {
+	status, err := c.AuthStatus(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get auth status: %w", err)
+	}
+
+	state := &AuthState{
+		Enabled:        status.Enabled,
+		RootConfigured: RootPasswordConfigured(),
+	}
+
+	if state.Enabled && state.RootConfigured {
+		for _, key := range []string{"ETCD_ROOT_PASSWORD_NEXT", "ETCD_ROOT_PASSWORD"} {
+			password := os.Getenv(key)
+			if password == "" {
+				continue
+			}
+			if _, err := c.Authenticate(ctx, rootName, password); err != nil {
+				state.RootErr = err
+				continue
+			}
+			state.RootValid = true
+			state.RootSecret = key
+			state.RootErr = nil
+			break
+		}
+	}
+
+	return state, nil
+}
+
+// GenerateRootPassword returns a random password suitable for the root user.
+func GenerateRootPassword() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// RotateRootPassword changes the root password and verifies that every started, voting member
+// accepts it.
+func (c *Client) RotateRootPassword(ctx context.Context, password string) error {
+	if _, err := c.UserChangePassword(ctx, rootName, password); err != nil {
+		return fmt.Errorf("failed to change root password: %w", err)
+	}
+
+	resp, err := c.MemberList(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list members: %w", err)
+	}
+
+	for _, member := range resp.Members {
+		if member.Name == "" || member.IsLearner || len(member.ClientURLs) == 0 {
+			continue
+		}
+		if err := verifyRootPassword(ctx, member.ClientURLs[0], password); err != nil {
+			return fmt.Errorf("member %s did not accept the new root password: %w", member.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// verifyRootPassword logs in as root against a single member. The password change may take a
+// moment to be applied by every member, so failed attempts are retried.
+func verifyRootPassword(ctx context.Context, clientURL, password string) error {
+	tick := time.NewTicker(1 * time.Second)
+	defer tick.Stop()
+
+	for {
+		c, err := newClient([]string{clientURL}, []string{password})
+		if err == nil {
+			return c.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-tick.C:
+		}
+	}
+}
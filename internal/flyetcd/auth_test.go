@@ -0,0 +1,222 @@
+package flyetcd
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	client "go.etcd.io/etcd/client/v3"
+)
+
+func TestRootPasswords(t *testing.T) {
+	t.Run("not configured", func(t *testing.T) {
+		t.Setenv("ETCD_ROOT_PASSWORD", "")
+		t.Setenv("ETCD_ROOT_PASSWORD_NEXT", "")
+		if got := rootPasswords(); len(got) != 0 {
+			t.Errorf("expected no passwords, got %v", got)
+		}
+	})
+
+	t.Run("staged password is tried first", func(t *testing.T) {
+		t.Setenv("ETCD_ROOT_PASSWORD", "current")
+		t.Setenv("ETCD_ROOT_PASSWORD_NEXT", "next")
+		if got := rootPasswords(); !reflect.DeepEqual(got, []string{"next", "current"}) {
+			t.Errorf("expected [next current], got %v", got)
+		}
+	})
+}
+
+func TestGenerateRootPassword(t *testing.T) {
+	a, err := GenerateRootPassword()
+	if err != nil {
+		t.Fatalf("GenerateRootPassword failed: %v", err)
+	}
+	b, err := GenerateRootPassword()
+	if err != nil {
+		t.Fatalf("GenerateRootPassword failed: %v", err)
+	}
+	if len(a) != 32 || a == b {
+		t.Errorf("expected distinct 32 character passwords, got %q and %q", a, b)
+	}
+}
+
+// fakeAuth implements the parts of the auth API used to enable auth and check its state.
+type fakeAuth struct {
+	client.Auth
+
+	enabled      bool
+	rootExists   bool
+	rootPassword string
+	calls        []string
+}
+
+func (f *fakeAuth) AuthStatus(context.Context) (*client.AuthStatusResponse, error) {
+	f.calls = append(f.calls, "status")
+	return &client.AuthStatusResponse{Enabled: f.enabled}, nil
+}
+
+func (f *fakeAuth) RoleAdd(_ context.Context, name string) (*client.AuthRoleAddResponse, error) {
+	f.calls = append(f.calls, "role-add "+name)
+	return &client.AuthRoleAddResponse{}, nil
+}
+
+func (f *fakeAuth) UserAdd(_ context.Context, name, password string) (*client.AuthUserAddResponse, error) {
+	f.calls = append(f.calls, "user-add "+name)
+	if f.rootExists {
+		return nil, rpctypes.ErrUserAlreadyExist
+	}
+	f.rootExists = true
+	f.rootPassword = password
+	return &client.AuthUserAddResponse{}, nil
+}
+
+func (f *fakeAuth) UserChangePassword(_ context.Context, name, password string) (*client.AuthUserChangePasswordResponse, error) {
+	f.calls = append(f.calls, "change-password "+name)
+	f.rootPassword = password
+	return &client.AuthUserChangePasswordResponse{}, nil
+}
+
+func (f *fakeAuth) UserGrantRole(_ context.Context, user, role string) (*client.AuthUserGrantRoleResponse, error) {
+	f.calls = append(f.calls, "grant "+user+" "+role)
+	return &client.AuthUserGrantRoleResponse{}, nil
+}
+
+func (f *fakeAuth) AuthEnable(context.Context) (*client.AuthEnableResponse, error) {
+	f.calls = append(f.calls, "enable")
+	f.enabled = true
+	return &client.AuthEnableResponse{}, nil
+}
+
+func (f *fakeAuth) Authenticate(_ context.Context, name, password string) (*client.AuthenticateResponse, error) {
+	if name != rootName || password != f.rootPassword {
+		return nil, rpctypes.ErrAuthFailed
+	}
+	return &client.AuthenticateResponse{}, nil
+}
+
+func TestEnableAuth(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("enables auth", func(t *testing.T) {
+		auth := &fakeAuth{}
+		if err := enableAuth(ctx, auth, "secret"); err != nil {
+			t.Fatalf("enableAuth failed: %v", err)
+		}
+		expected := []string{"status", "role-add root", "user-add root", "grant root root", "enable"}
+		if !reflect.DeepEqual(auth.calls, expected) {
+			t.Errorf("expected %v, got %v", expected, auth.calls)
+		}
+		if !auth.enabled || auth.rootPassword != "secret" {
+			t.Errorf("expected auth enabled with the root password set, got %+v", auth)
+		}
+	})
+
+	t.Run("already enabled", func(t *testing.T) {
+		auth := &fakeAuth{enabled: true, rootExists: true, rootPassword: "other"}
+		if err := enableAuth(ctx, auth, "secret"); err != nil {
+			t.Fatalf("enableAuth failed: %v", err)
+		}
+		if !reflect.DeepEqual(auth.calls, []string{"status"}) {
+			t.Errorf("expected only a status check, got %v", auth.calls)
+		}
+		if auth.rootPassword != "other" {
+			t.Error("expected the root password to be left alone")
+		}
+	})
+
+	t.Run("root user left over", func(t *testing.T) {
+		auth := &fakeAuth{rootExists: true, rootPassword: "stale"}
+		if err := enableAuth(ctx, auth, "secret"); err != nil {
+			t.Fatalf("enableAuth failed: %v", err)
+		}
+		if auth.rootPassword != "secret" {
+			t.Errorf("expected the root password to be reset, got %q", auth.rootPassword)
+		}
+	})
+}
+
+func TestAuthState(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("password accepted", func(t *testing.T) {
+		t.Setenv("ETCD_ROOT_PASSWORD", "secret")
+		t.Setenv("ETCD_ROOT_PASSWORD_NEXT", "")
+		state, err := authState(ctx, &fakeAuth{enabled: true, rootPassword: "secret"})
+		if err != nil {
+			t.Fatalf("authState failed: %v", err)
+		}
+		if !state.Enabled || !state.RootValid || state.RootSecret != "ETCD_ROOT_PASSWORD" {
+			t.Errorf("unexpected state %+v", state)
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		t.Setenv("ETCD_ROOT_PASSWORD", "wrong")
+		t.Setenv("ETCD_ROOT_PASSWORD_NEXT", "")
+		state, err := authState(ctx, &fakeAuth{enabled: true, rootPassword: "secret"})
+		if err != nil {
+			t.Fatalf("authState failed: %v", err)
+		}
+		if state.RootValid || !errors.Is(state.RootErr, rpctypes.ErrAuthFailed) {
+			t.Errorf("expected the password to be rejected, got %+v", state)
+		}
+	})
+
+	t.Run("staged password accepted", func(t *testing.T) {
+		t.Setenv("ETCD_ROOT_PASSWORD", "old")
+		t.Setenv("ETCD_ROOT_PASSWORD_NEXT", "secret")
+		state, err := authState(ctx, &fakeAuth{enabled: true, rootPassword: "secret"})
+		if err != nil {
+			t.Fatalf("authState failed: %v", err)
+		}
+		if !state.RootValid || state.RootSecret != "ETCD_ROOT_PASSWORD_NEXT" {
+			t.Errorf("unexpected state %+v", state)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		t.Setenv("ETCD_ROOT_PASSWORD", "wrong")
+		t.Setenv("ETCD_ROOT_PASSWORD_NEXT", "")
+		state, err := authState(ctx, &fakeAuth{rootPassword: "secret"})
+		if err != nil {
+			t.Fatalf("authState failed: %v", err)
+		}
+		// Credentials aren't checked while auth is disabled.
+		if state.Enabled || state.RootValid || state.RootErr != nil {
+			t.Errorf("unexpected state %+v", state)
+		}
+	})
+}
+
+func TestAuthSetupPending(t *testing.T) {
+	setupTestDirs(t)
+
+	t.Run("joined member", func(t *testing.T) {
+		journal := &BootstrapJournal{}
+		if err := journal.advance(BootstrapStateConfigWritten); err != nil {
+			t.Fatalf("advance failed: %v", err)
+		}
+		if pending, err := AuthSetupPending(); err != nil || pending {
+			t.Errorf("expected no pending setup, got %v (%v)", pending, err)
+		}
+	})
+
+	t.Run("founder", func(t *testing.T) {
+		journal := &BootstrapJournal{Founder: true}
+		if err := journal.advance(BootstrapStateConfigWritten); err != nil {
+			t.Fatalf("advance failed: %v", err)
+		}
+		if pending, err := AuthSetupPending(); err != nil || !pending {
+			t.Fatalf("expected pending setup, got %v (%v)", pending, err)
+		}
+
+		if err := RecordAuthEnabled(); err != nil {
+			t.Fatalf("RecordAuthEnabled failed: %v", err)
+		}
+		if pending, err := AuthSetupPending(); err != nil || pending {
+			t.Errorf("expected no pending setup once enabled, got %v (%v)", pending, err)
+		}
+	})
+}
@@ -0,0 +1,189 @@
+package flyetcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const backupTimestampFormat = "20060102T150405Z"
+
+// ErrBackupNotFound is returned when a backup doesn't exist, or no backup has been taken yet.
+var ErrBackupNotFound = errors.New("no backups found")
+
+// BackupVersion describes a stored backup.
+type BackupVersion struct {
+	IsLatest     bool
+	VersionID    string
+	LastModified time.Time
+	Size         int64
+	// Revision is the etcd revision the backup was taken at. Zero when the store doesn't record it.
+	Revision int64
+	// KeyID identifies the key the backup was encrypted with. Empty for unencrypted backups. Only
+	// populated by Metadata, and by listings of stores that can read it without fetching each backup.
+	KeyID string
+}
+
+// BackupStore stores etcd snapshots.
+type BackupStore interface {
+	// Upload stores the snapshot taken at the specified revision and returns its ID. The ID of
+	// the key the snapshot is encrypted with, if any, is recorded alongside it.
+	Upload(ctx context.Context, r io.Reader, revision int64, keyID string) (string, error)
+	// List returns the stored backups, newest first.
+	List(ctx context.Context) ([]BackupVersion, error)
+	// Download writes the backup to the specified directory and returns its path.
+	Download(ctx context.Context, directory, id string) (string, error)
+	// Latest returns the newest backup, or ErrBackupNotFound when there are none.
+	Latest(ctx context.Context) (BackupVersion, error)
+	// Delete removes the backup.
+	Delete(ctx context.Context, id string) error
+	// Metadata describes the backup, or returns ErrBackupNotFound when it doesn't exist.
+	Metadata(ctx context.Context, id string) (BackupVersion, error)
+	// Location returns a human readable description of where backups are stored.
+	Location() string
+}
+
+// BackupStoreFactory opens the backup store described by the URL.
+type BackupStoreFactory func(ctx context.Context, u *url.URL) (BackupStore, error)
+
+var backupStores = map[string]BackupStoreFactory{
+	"s3":   newS3BackupStore,
+	"file": newFileBackupStore,
+}
+
+// RegisterBackupStore registers a backup store for the URL scheme.
+func RegisterBackupStore(scheme string, factory BackupStoreFactory) {
+	backupStores[scheme] = factory
+}
+
+// NewBackupStore opens the backup store for the URL, selected by its scheme.
+func NewBackupStore(ctx context.Context, rawURL string) (BackupStore, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup url %q: %w", rawURL, err)
+	}
+
+	factory, ok := backupStores[u.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported backup store %q", u.Scheme)
+	}
+
+	return factory(ctx, u)
+}
+
+// OpenBackupStore opens the backup store configured for this cluster, encrypting backups when
+// BACKUP_ENCRYPTION_KEY is set.
+func OpenBackupStore(ctx context.Context) (BackupStore, error) {
+	keys, err := ResolveBackupKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := NewBackupStore(ctx, ResolveBackupURL())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return store, nil
+	}
+	return NewEncryptedStore(store, keys)
+}
+
+// ResolveBackupURL returns BACKUP_URL, falling back to S3_BUCKET and the app name.
+func ResolveBackupURL() string {
+	if u := os.Getenv("BACKUP_URL"); u != "" {
+		return u
+	}
+	return fmt.Sprintf("s3://%s/%s", resolveS3Bucket(), os.Getenv("FLY_APP_NAME"))
+}
+
+// UploadBackup uploads the snapshot file taken at the specified revision and returns its ID.
+func UploadBackup(ctx context.Context, store BackupStore, backupPath string, revision int64) (string, error) {
+	file, err := os.Open(backupPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open backup file: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return store.Upload(ctx, file, revision, "")
+}
+
+// FetchBackup downloads the backup and verifies it's a valid snapshot.
+func FetchBackup(ctx context.Context, store BackupStore, directory, id string) (string, error) {
+	snapshotPath, err := store.Download(ctx, directory, id)
+	if err != nil {
+		return "", err
+	}
+
+	// Encrypted stores decrypt on download, so an envelope here means no key is configured.
+	keyID, err := readBackupKeyID(snapshotPath)
+	if err != nil {
+		return "", err
+	}
+	if keyID != "" {
+		return "", fmt.Errorf("backup %s is encrypted with key %s, set BACKUP_ENCRYPTION_KEY or BACKUP_ENCRYPTION_KEY_PREVIOUS to restore it", id, keyID)
+	}
+
+	if err := VerifySnapshot(snapshotPath); err != nil {
+		return "", err
+	}
+
+	return snapshotPath, nil
+}
+
+// VerifySnapshot checks the snapshot's integrity, printing its status.
+func VerifySnapshot(snapshotPath string) error {
+	cmd := exec.Command("etcdutl", "snapshot", "status", snapshotPath, "--write-out", "table")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("snapshot verification failed: %v", err)
+	}
+	return nil
+}
+
+// backupKey returns the key of a backup taken at the specified time and revision. Keys sort
+// chronologically.
+func backupKey(t time.Time, revision int64) string {
+	t = t.UTC()
+	return path.Join(t.Format("2006"), t.Format("01"), fmt.Sprintf("%s-%d.db", t.Format(backupTimestampFormat), revision))
+}
+
+// parseBackupKey parses a key produced by backupKey.
+func parseBackupKey(key string) (time.Time, int64, bool) {
+	parts := strings.Split(key, "/")
+	if len(parts) != 3 {
+		return time.Time{}, 0, false
+	}
+
+	ts, rev, found := strings.Cut(strings.TrimSuffix(parts[2], ".db"), "-")
+	if !found || !strings.HasSuffix(parts[2], ".db") {
+		return time.Time{}, 0, false
+	}
+
+	t, err := time.Parse(backupTimestampFormat, ts)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+	if parts[0] != t.Format("2006") || parts[1] != t.Format("01") {
+		return time.Time{}, 0, false
+	}
+
+	revision, err := strconv.ParseInt(rev, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+
+	return t, revision, true
+}
@@ -0,0 +1,196 @@
+package flyetcd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBackupKey(t *testing.T) {
+	t.Run("round trip", func(t *testing.T) {
+		taken := time.Date(2024, time.March, 5, 14, 30, 15, 0, time.UTC)
+
+		key := backupKey(taken, 1234)
+		if key != "2024/03/20240305T143015Z-1234.db" {
+			t.Fatalf("unexpected key %q", key)
+		}
+
+		ts, revision, ok := parseBackupKey(key)
+		if !ok {
+			t.Fatalf("failed to parse key %q", key)
+		}
+		if !ts.Equal(taken) {
+			t.Errorf("expected timestamp %s, got %s", taken, ts)
+		}
+		if revision != 1234 {
+			t.Errorf("expected revision 1234, got %d", revision)
+		}
+	})
+
+	t.Run("keys sort chronologically", func(t *testing.T) {
+		older := backupKey(time.Date(2024, time.September, 30, 23, 0, 0, 0, time.UTC), 99999)
+		newer := backupKey(time.Date(2024, time.October, 1, 0, 0, 0, 0, time.UTC), 100)
+		if older >= newer {
+			t.Errorf("expected %q to sort before %q", older, newer)
+		}
+	})
+
+	t.Run("invalid keys", func(t *testing.T) {
+		for _, key := range []string{
+			"etcd-backup.db",
+			"2024/03/20240305T143015Z.db",
+			"2024/03/20240305T143015Z-abc.db",
+			"2024/03/20240305T143015Z-1234",
+			"2024/04/20240305T143015Z-1234.db",
+			"backups/2024/03/20240305T143015Z-1234.db",
+		} {
+			if _, _, ok := parseBackupKey(key); ok {
+				t.Errorf("expected %q to be rejected", key)
+			}
+		}
+	})
+}
+
+func TestNewBackupStore(t *testing.T) {
+	t.Run("file", func(t *testing.T) {
+		root := filepath.Join(t.TempDir(), "backups")
+
+		store, err := NewBackupStore(context.Background(), "file://"+root)
+		if err != nil {
+			t.Fatalf("NewBackupStore failed: %v", err)
+		}
+		if store.Location() != "file://"+root {
+			t.Errorf("unexpected location %q", store.Location())
+		}
+		if _, err := os.Stat(root); err != nil {
+			t.Errorf("expected backup directory to be created: %v", err)
+		}
+	})
+
+	t.Run("relative file path", func(t *testing.T) {
+		if _, err := NewBackupStore(context.Background(), "file://backups"); err == nil {
+			t.Error("expected an error for a file url with a host")
+		}
+	})
+
+	t.Run("unsupported scheme", func(t *testing.T) {
+		if _, err := NewBackupStore(context.Background(), "gs://bucket/app"); err == nil {
+			t.Error("expected an error for an unsupported scheme")
+		}
+	})
+
+	t.Run("default url", func(t *testing.T) {
+		t.Setenv("FLY_APP_NAME", "my-etcd")
+		if u := ResolveBackupURL(); u != "s3://fly-etcd-backups/my-etcd" {
+			t.Errorf("unexpected default url %q", u)
+		}
+
+		t.Setenv("S3_BUCKET", "custom")
+		if u := ResolveBackupURL(); u != "s3://custom/my-etcd" {
+			t.Errorf("unexpected url %q", u)
+		}
+
+		t.Setenv("BACKUP_URL", "file:///mnt/backups")
+		if u := ResolveBackupURL(); u != "file:///mnt/backups" {
+			t.Errorf("unexpected url %q", u)
+		}
+	})
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+
+	snapshot := filepath.Join(t.TempDir(), "snapshot.db")
+	if err := os.WriteFile(snapshot, []byte("snapshot"), 0600); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		if _, err := store.Latest(ctx); !errors.Is(err, ErrBackupNotFound) {
+			t.Errorf("expected ErrBackupNotFound, got %v", err)
+		}
+	})
+
+	var first, second string
+	t.Run("upload", func(t *testing.T) {
+		var err error
+		if first, err = UploadBackup(ctx, store, snapshot, 10); err != nil {
+			t.Fatalf("upload failed: %v", err)
+		}
+		// Keys have second precision
+		time.Sleep(1100 * time.Millisecond)
+		if second, err = UploadBackup(ctx, store, snapshot, 20); err != nil {
+			t.Fatalf("upload failed: %v", err)
+		}
+
+		versions, err := store.List(ctx)
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		if len(versions) != 2 {
+			t.Fatalf("expected 2 backups, got %d", len(versions))
+		}
+		if versions[0].VersionID != second || !versions[0].IsLatest || versions[0].Revision != 20 {
+			t.Errorf("expected %s to be the latest, got %+v", second, versions[0])
+		}
+		if versions[1].VersionID != first || versions[1].IsLatest {
+			t.Errorf("expected %s to be listed second, got %+v", first, versions[1])
+		}
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		meta, err := store.Metadata(ctx, first)
+		if err != nil {
+			t.Fatalf("metadata failed: %v", err)
+		}
+		if meta.Size != int64(len("snapshot")) || meta.Revision != 10 {
+			t.Errorf("unexpected metadata %+v", meta)
+		}
+	})
+
+	t.Run("download", func(t *testing.T) {
+		path, err := store.Download(ctx, t.TempDir(), first)
+		if err != nil {
+			t.Fatalf("download failed: %v", err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("failed to read download: %v", err)
+		}
+		if string(data) != "snapshot" {
+			t.Errorf("unexpected contents %q", data)
+		}
+	})
+
+	t.Run("invalid id", func(t *testing.T) {
+		if _, err := store.Download(ctx, t.TempDir(), "../../etc/passwd"); err == nil {
+			t.Error("expected an error for an invalid id")
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := store.Delete(ctx, second); err != nil {
+			t.Fatalf("delete failed: %v", err)
+		}
+
+		latest, err := store.Latest(ctx)
+		if err != nil {
+			t.Fatalf("latest failed: %v", err)
+		}
+		if latest.VersionID != first {
+			t.Errorf("expected %s to be the latest, got %s", first, latest.VersionID)
+		}
+
+		if err := store.Delete(ctx, second); !errors.Is(err, ErrBackupNotFound) {
+			t.Errorf("expected ErrBackupNotFound, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,212 @@
+package flyetcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fly-apps/fly-etcd/internal/privnet"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// discoverySettlePeriod is how long the set of machines reported by DNS must remain
+	// unchanged before we trust it enough to elect a seed.
+	discoverySettlePeriod = 10 * time.Second
+	discoveryTimeout      = 2 * time.Minute
+
+	// staticDiscoveryTimeout is how long to wait for every machine to come up when the
+	// initial cluster size is configured.
+	staticDiscoveryTimeout = 10 * time.Minute
+
+	// seedWaitTimeout is how long a non-seed machine will wait for the seed to form the cluster.
+	seedWaitTimeout = 5 * time.Minute
+)
+
+// discoverMachines polls DNS until at least minMachines are associated with the app and the
+// set of machines has been stable for the settle period. Machines that boot together will not
+// necessarily see each other right away, so a single lookup isn't enough to safely elect a seed.
+func discoverMachines(ctx context.Context, minMachines int, timeout time.Duration) ([]privnet.Machine, error) {
+	deadline := time.After(timeout)
+	tick := time.NewTicker(1 * time.Second)
+	defer tick.Stop()
+
+	var (
+		last        []string
+		machines    []privnet.Machine
+		stableSince time.Time
+	)
+
+	for {
+		current, err := privnet.AllMachines(ctx, os.Getenv("FLY_APP_NAME"))
+		if err == nil && len(current) >= minMachines {
+			ids := machineIDs(current)
+			if !reflect.DeepEqual(ids, last) {
+				last = ids
+				machines = current
+				stableSince = time.Now()
+			} else if time.Since(stableSince) >= discoverySettlePeriod {
+				return machines, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline:
+			return nil, fmt.Errorf("timed out waiting for %d machine(s) to be discovered", minMachines)
+		case <-tick.C:
+		}
+	}
+}
+
+// electSeed deterministically selects the machine responsible for forming a new cluster.
+// Every machine evaluates the same DNS records, so they all agree on the lowest machine ID.
+func electSeed(machines []privnet.Machine) (string, error) {
+	ids := machineIDs(machines)
+	if len(ids) == 0 {
+		return "", fmt.Errorf("no machines discovered")
+	}
+	return ids[0], nil
+}
+
+// resumeSeed returns the seed elected by a previous boot when it's still among the discovered
+// machines. Sticking with it keeps a restarted machine from switching seeds when a machine
+// with a lower ID has appeared since. Returns an empty string when a new election is needed.
+func resumeSeed(journal *BootstrapJournal, machines []privnet.Machine) string {
+	if journal.State != BootstrapStateDiscovered || journal.Seed == "" {
+		return ""
+	}
+	if !slices.Contains(machineIDs(machines), journal.Seed) {
+		return ""
+	}
+	return journal.Seed
+}
+
+// initialClusterSize returns the number of machines expected to form the cluster together.
+// Returns 0 when static bootstrapping is disabled.
+func initialClusterSize() int {
+	size := getEnvOrDefault("ETCD_INITIAL_CLUSTER_SIZE", 0)
+	if size < 0 {
+		log.Printf("invalid initial cluster size %d, ignoring", size)
+		return 0
+	}
+	return size
+}
+
+// staticMembers selects the machines that will form the initial cluster. Every machine
+// evaluates the same DNS records, so they all agree on the lowest N machine IDs.
+func staticMembers(machines []privnet.Machine, size int) []string {
+	ids := machineIDs(machines)
+	if len(ids) > size {
+		ids = ids[:size]
+	}
+	return ids
+}
+
+// staticInitialCluster builds the initial cluster string for the specified machines.
+func staticInitialCluster(machineIDs []string) string {
+	var peers []string
+	for _, id := range machineIDs {
+		endpoint := NewEndpoint(id)
+		peers = append(peers, fmt.Sprintf("%s=%s", endpoint.Name, endpoint.PeerURL))
+	}
+	return strings.Join(peers, ",")
+}
+
+// waitForCluster blocks until another machine reports that the cluster has been initialized.
+func waitForCluster(ctx context.Context, client *Client, node *Node) error {
+	timeout := time.After(seedWaitTimeout)
+	tick := time.NewTicker(5 * time.Second)
+	defer tick.Stop()
+
+	for {
+		ready, err := clusterInitialized(ctx, client, node)
+		if err != nil {
+			log.Printf("[warn] failed to verify cluster state: %v", err)
+		}
+		if ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout:
+			return fmt.Errorf("timed out waiting for the cluster to be initialized")
+		case <-tick.C:
+		}
+	}
+}
+
+// addMember registers the peer URL with the cluster as a learner, so the new member can't
+// cost the cluster quorum while its snapshot is still streaming. etcd rejects membership
+// changes while a previously added member has yet to start, which is expected when several
+// machines join at once, so failed attempts are retried until the timeout is reached.
+func addMember(ctx context.Context, client *Client, peerURL string) (*clientv3.MemberAddResponse, error) {
+	timeout := time.After(seedWaitTimeout)
+	tick := time.NewTicker(5 * time.Second)
+	defer tick.Stop()
+
+	for {
+		mCtx, cancel := context.WithTimeout(ctx, (5 * time.Second))
+		resp, err := client.MemberAddAsLearner(mCtx, []string{peerURL})
+		cancel()
+		if err == nil {
+			return resp, nil
+		}
+		if errors.Is(err, rpctypes.ErrPeerURLExist) {
+			return nil, err
+		}
+		log.Printf("[warn] failed to add member, retrying: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout:
+			return nil, fmt.Errorf("timed out adding member: %w", err)
+		case <-tick.C:
+		}
+	}
+}
+
+// removeStaleMember removes a previous registration of this machine. This happens when a
+// machine comes back with an empty volume while its member is still registered, in which
+// case adding it again would be rejected because the peer URL is already in use.
+func removeStaleMember(ctx context.Context, client *Client, node *Node) error {
+	mCtx, cancel := context.WithTimeout(ctx, (10 * time.Second))
+	defer cancel()
+
+	id, err := client.MemberID(mCtx, node.MachineID)
+	if err != nil {
+		var notFound *MemberNotFoundError
+		if errors.As(err, &notFound) {
+			return nil
+		}
+		return err
+	}
+
+	log.Printf("Member %x is still registered for this machine, but its data is gone. Removing it.", id)
+	if _, err := client.MemberRemove(mCtx, id); err != nil {
+		return fmt.Errorf("failed to remove stale member %x: %w", id, err)
+	}
+
+	return nil
+}
+
+func machineIDs(machines []privnet.Machine) []string {
+	ids := make([]string, 0, len(machines))
+	for _, m := range machines {
+		ids = append(ids, m.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
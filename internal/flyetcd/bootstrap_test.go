@@ -0,0 +1,177 @@
+package flyetcd
+
+import (
+	"testing"
+
+	"github.com/fly-apps/fly-etcd/internal/privnet"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+// Every machine must independently arrive at the same seed, regardless of the order
+// DNS returns the records in.
+func TestElectSeed(t *testing.T) {
+	t.Run("lowest machine id wins", func(t *testing.T) {
+		machines := []privnet.Machine{
+			{ID: "3d8d9e0a", Region: "ord"},
+			{ID: "148e21da", Region: "iad"},
+			{ID: "9185e73f", Region: "ord"},
+		}
+
+		seed, err := electSeed(machines)
+		if err != nil {
+			t.Fatalf("electSeed failed: %v", err)
+		}
+		if seed != "148e21da" {
+			t.Errorf("expected seed '148e21da', got %q", seed)
+		}
+	})
+
+	t.Run("order does not matter", func(t *testing.T) {
+		a := []privnet.Machine{{ID: "b"}, {ID: "a"}, {ID: "c"}}
+		b := []privnet.Machine{{ID: "c"}, {ID: "b"}, {ID: "a"}}
+
+		seedA, _ := electSeed(a)
+		seedB, _ := electSeed(b)
+		if seedA != seedB {
+			t.Errorf("expected the same seed, got %q and %q", seedA, seedB)
+		}
+	})
+
+	t.Run("no machines", func(t *testing.T) {
+		if _, err := electSeed(nil); err == nil {
+			t.Error("expected error with no machines, got nil")
+		}
+	})
+}
+
+func TestMachineIDFromPeerURL(t *testing.T) {
+	t.Setenv("FLY_APP_NAME", "test-app")
+
+	id := machineIDFromPeerURL("http://148e21da.vm.test-app.internal:2380")
+	if id != "148e21da" {
+		t.Errorf("expected '148e21da', got %q", id)
+	}
+
+	if id := machineIDFromPeerURL("://bad"); id != "" {
+		t.Errorf("expected empty id for invalid url, got %q", id)
+	}
+
+	if id := machineIDFromPeerURL("http://10.0.0.1:2380"); id != "" {
+		t.Errorf("expected empty id for a custom peer url, got %q", id)
+	}
+}
+
+func TestInitialCluster(t *testing.T) {
+	t.Setenv("FLY_APP_NAME", "test-app")
+
+	members := []*etcdserverpb.Member{
+		{ID: 1, Name: "148e21da", PeerURLs: []string{"http://148e21da.vm.test-app.internal:2380"}},
+		// Another machine that was added, but hasn't started yet.
+		{ID: 2, PeerURLs: []string{"http://3d8d9e0a.vm.test-app.internal:2380"}},
+		// The member we just added.
+		{ID: 3, PeerURLs: []string{"http://9185e73f.vm.test-app.internal:2380"}},
+	}
+
+	expected := "148e21da=http://148e21da.vm.test-app.internal:2380," +
+		"3d8d9e0a=http://3d8d9e0a.vm.test-app.internal:2380," +
+		"9185e73f=http://9185e73f.vm.test-app.internal:2380"
+
+	if got := initialCluster(members, 3, "9185e73f"); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestBootstrapJournal(t *testing.T) {
+	t.Run("missing journal starts fresh", func(t *testing.T) {
+		setupTestDirs(t)
+
+		journal, err := readBootstrapJournal()
+		if err != nil {
+			t.Fatalf("readBootstrapJournal failed: %v", err)
+		}
+		if journal.State != "" {
+			t.Errorf("expected empty state, got %q", journal.State)
+		}
+	})
+
+	t.Run("progress survives a restart", func(t *testing.T) {
+		setupTestDirs(t)
+
+		journal, err := readBootstrapJournal()
+		if err != nil {
+			t.Fatalf("readBootstrapJournal failed: %v", err)
+		}
+
+		journal.MemberID = 0x8e9e05c52164694d
+		if err := journal.advance(BootstrapStateMemberAdded); err != nil {
+			t.Fatalf("advance failed: %v", err)
+		}
+
+		resumed, err := readBootstrapJournal()
+		if err != nil {
+			t.Fatalf("readBootstrapJournal failed: %v", err)
+		}
+		if resumed.State != BootstrapStateMemberAdded {
+			t.Errorf("expected state %q, got %q", BootstrapStateMemberAdded, resumed.State)
+		}
+		if resumed.MemberID != 0x8e9e05c52164694d {
+			t.Errorf("expected member id 8e9e05c52164694d, got %x", resumed.MemberID)
+		}
+	})
+}
+
+func TestStaticInitialCluster(t *testing.T) {
+	t.Setenv("FLY_APP_NAME", "test-app")
+
+	machines := []privnet.Machine{
+		{ID: "9185e73f"},
+		{ID: "148e21da"},
+		{ID: "5a2b7c11"},
+		{ID: "3d8d9e0a"},
+	}
+
+	// Only the lowest N machines form the initial cluster.
+	members := staticMembers(machines, 3)
+	if len(members) != 3 {
+		t.Fatalf("expected 3 members, got %d", len(members))
+	}
+
+	expected := "148e21da=http://148e21da.vm.test-app.internal:2380," +
+		"3d8d9e0a=http://3d8d9e0a.vm.test-app.internal:2380," +
+		"5a2b7c11=http://5a2b7c11.vm.test-app.internal:2380"
+
+	if got := staticInitialCluster(members); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestResumeSeed(t *testing.T) {
+	machines := []privnet.Machine{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+
+	t.Run("previous seed still running", func(t *testing.T) {
+		journal := &BootstrapJournal{State: BootstrapStateDiscovered, Seed: "b"}
+		if seed := resumeSeed(journal, machines); seed != "b" {
+			t.Errorf("expected seed 'b', got %q", seed)
+		}
+	})
+
+	t.Run("previous seed gone", func(t *testing.T) {
+		journal := &BootstrapJournal{State: BootstrapStateDiscovered, Seed: "d"}
+		if seed := resumeSeed(journal, machines); seed != "" {
+			t.Errorf("expected a new election, got %q", seed)
+		}
+	})
+
+	t.Run("no seed elected", func(t *testing.T) {
+		if seed := resumeSeed(&BootstrapJournal{}, machines); seed != "" {
+			t.Errorf("expected a new election, got %q", seed)
+		}
+	})
+
+	t.Run("later step", func(t *testing.T) {
+		journal := &BootstrapJournal{State: BootstrapStateMemberAdded, Seed: "b"}
+		if seed := resumeSeed(journal, machines); seed != "" {
+			t.Errorf("expected a new election, got %q", seed)
+		}
+	})
+}
@@ -0,0 +1,202 @@
+package flyetcd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	defaultCertRenewDays      = 30
+	defaultCertExpiryWarnDays = 14
+)
+
+// CertificateInfo describes a certificate and where it was found.
+type CertificateInfo struct {
+	Member   string    `json:"member,omitempty"`
+	Source   string    `json:"source"`
+	NotAfter time.Time `json:"not_after"`
+	// Error is set when the certificate couldn't be inspected.
+	Error string `json:"error,omitempty"`
+}
+
+// CertRenewBefore returns how long before expiry certificates are reissued. It must be shorter
+// than the validity of issued certificates, otherwise they'd be reissued on every boot.
+func CertRenewBefore() time.Duration {
+	renewBefore := certDays("ETCD_CERT_RENEW_DAYS", defaultCertRenewDays)
+	if renewBefore >= defaultCertValidity {
+		log.Printf("ETCD_CERT_RENEW_DAYS must be less than the certificate validity of %s, using default %d",
+			defaultCertValidity, defaultCertRenewDays)
+		return defaultCertRenewDays * 24 * time.Hour
+	}
+	return renewBefore
+}
+
+// CertExpiryWarnBefore returns how long before expiry certificates fail the health checks.
+func CertExpiryWarnBefore() time.Duration {
+	return certDays("ETCD_CERT_EXPIRY_WARN_DAYS", defaultCertExpiryWarnDays)
+}
+
+func certDays(key string, fallback int) time.Duration {
+	days := getEnvOrDefault(key, fallback)
+	if days <= 0 {
+		log.Printf("invalid value %d for %s, using default %d", days, key, fallback)
+		days = fallback
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// LocalCertificates returns the certificates issued to this machine.
+func (c *Config) LocalCertificates() ([]CertificateInfo, error) {
+	var paths []string
+	if c.PeerTransportSecurity.CertFile != "" {
+		paths = append(paths, c.PeerTransportSecurity.CertFile)
+	}
+	if c.ClientTransportSecurity.CertFile != "" {
+		paths = append(paths, c.ClientTransportSecurity.CertFile, filepath.Join(certsDir(), "client.crt"))
+	}
+
+	var certs []CertificateInfo
+	for _, path := range paths {
+		cert, err := readCertificate(path)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, CertificateInfo{Source: path, NotAfter: cert.NotAfter})
+	}
+	return certs, nil
+}
+
+// RenewalDue returns true if any of this machine's certificates expire within the specified duration.
+func (c *Config) RenewalDue(now time.Time, within time.Duration) (bool, error) {
+	certs, err := c.LocalCertificates()
+	if err != nil {
+		return false, err
+	}
+	return len(ExpiringCertificates(certs, now, within)) > 0, nil
+}
+
+// ReissueCertificates issues fresh peer and client certificates and writes the updated config.
+// Etcd must be restarted to pick them up.
+func (n *Node) ReissueCertificates() error {
+	if err := n.Config.SetPeerTLS(n.Endpoint); err != nil {
+		return err
+	}
+	if err := n.Config.SetClientTLS(n.Endpoint); err != nil {
+		return err
+	}
+	return WriteConfig(n.Config)
+}
+
+// MemberCertificates dials the https peer and client URLs each member advertises and collects
+// the certificates they serve. Members that can't be inspected are reported with Error set,
+// rather than failing the whole listing.
+func (c *Client) MemberCertificates(ctx context.Context) ([]CertificateInfo, error) {
+	mCtx, cancel := context.WithTimeout(ctx, (5 * time.Second))
+	resp, err := c.MemberList(mCtx)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members: %w", err)
+	}
+
+	var certs []CertificateInfo
+	for _, member := range resp.Members {
+		name := member.Name
+		if name == "" {
+			name = fmt.Sprintf("%x", member.ID)
+		}
+
+		var targets []string
+		targets = append(targets, member.PeerURLs...)
+		targets = append(targets, member.ClientURLs...)
+		for _, target := range targets {
+			u, err := url.Parse(target)
+			if err != nil || u.Scheme != "https" {
+				continue
+			}
+
+			cert, err := servedCertificate(ctx, u.Host)
+			if err != nil {
+				certs = append(certs, CertificateInfo{Member: name, Source: target, Error: err.Error()})
+				continue
+			}
+			certs = append(certs, CertificateInfo{Member: name, Source: target, NotAfter: cert.NotAfter})
+		}
+	}
+	return certs, nil
+}
+
+// servedCertificate returns the leaf certificate presented by the TLS server at addr. The
+// certificate is only inspected, so it's captured before verification and the handshake is
+// allowed to fail when the server requires a client certificate.
+func servedCertificate(ctx context.Context, addr string) (*x509.Certificate, error) {
+	var leaf *x509.Certificate
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: 2 * time.Second},
+		Config: &tls.Config{
+			InsecureSkipVerify: true,
+			VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+				if len(rawCerts) == 0 {
+					return nil
+				}
+				cert, err := x509.ParseCertificate(rawCerts[0])
+				if err != nil {
+					return err
+				}
+				leaf = cert
+				return nil
+			},
+		},
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if conn != nil {
+		_ = conn.Close()
+	}
+	if leaf != nil {
+		return leaf, nil
+	}
+	if err == nil {
+		err = fmt.Errorf("no certificate presented")
+	}
+	return nil, err
+}
+
+// ExpiringCertificates returns the certificates that expire within the specified duration,
+// soonest first.
+func ExpiringCertificates(certs []CertificateInfo, now time.Time, within time.Duration) []CertificateInfo {
+	var expiring []CertificateInfo
+	for _, cert := range certs {
+		if cert.Error != "" {
+			continue
+		}
+		if cert.NotAfter.Sub(now) < within {
+			expiring = append(expiring, cert)
+		}
+	}
+	sort.Slice(expiring, func(i, j int) bool {
+		return expiring[i].NotAfter.Before(expiring[j].NotAfter)
+	})
+	return expiring
+}
+
+func readCertificate(path string) (*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
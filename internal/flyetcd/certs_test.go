@@ -0,0 +1,110 @@
+package flyetcd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpiringCertificates(t *testing.T) {
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	certs := []CertificateInfo{
+		{Source: "https://a:2379", NotAfter: now.Add(60 * 24 * time.Hour)},
+		{Source: "https://b:2380", NotAfter: now.Add(10 * 24 * time.Hour)},
+		{Source: "https://c:2379", NotAfter: now.Add(-time.Hour)},
+		// Listeners that couldn't be inspected are reported separately.
+		{Source: "https://d:2379", Error: "connection refused"},
+	}
+
+	expiring := ExpiringCertificates(certs, now, 14*24*time.Hour)
+	if len(expiring) != 2 {
+		t.Fatalf("expected 2 expiring certificates, got %d", len(expiring))
+	}
+	// Soonest first, including those that have already expired.
+	if expiring[0].Source != "https://c:2379" || expiring[1].Source != "https://b:2380" {
+		t.Errorf("unexpected order: %v", expiring)
+	}
+
+	if got := ExpiringCertificates(certs, now, 24*time.Hour); len(got) != 1 {
+		t.Errorf("expected 1 expired certificate, got %d", len(got))
+	}
+}
+
+func TestRenewalDue(t *testing.T) {
+	setupTestDirs(t)
+	setupTestCA(t)
+	t.Setenv("ETCD_PEER_TLS", "true")
+	t.Setenv("ETCD_CLIENT_TLS", "true")
+
+	config, err := NewConfig()
+	if err != nil {
+		t.Fatalf("NewConfig failed: %v", err)
+	}
+	if err := config.SetPeerTLS(NewEndpoint("")); err != nil {
+		t.Fatalf("SetPeerTLS failed: %v", err)
+	}
+	if err := config.SetClientTLS(NewEndpoint("")); err != nil {
+		t.Fatalf("SetClientTLS failed: %v", err)
+	}
+
+	certs, err := config.LocalCertificates()
+	if err != nil {
+		t.Fatalf("LocalCertificates failed: %v", err)
+	}
+	if len(certs) != 3 {
+		t.Errorf("expected peer, server and client certificates, got %d", len(certs))
+	}
+
+	now := time.Now()
+	if due, err := config.RenewalDue(now, 30*24*time.Hour); err != nil || due {
+		t.Errorf("expected freshly issued certificates not to be due, got %v (err: %v)", due, err)
+	}
+	if due, err := config.RenewalDue(now.Add(80*24*time.Hour), 30*24*time.Hour); err != nil || !due {
+		t.Errorf("expected certificates to be due, got %v (err: %v)", due, err)
+	}
+}
+
+func TestServedCertificate(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cert, err := servedCertificate(ctx, strings.TrimPrefix(server.URL, "https://"))
+	if err != nil {
+		t.Fatalf("servedCertificate failed: %v", err)
+	}
+	if !cert.NotAfter.Equal(server.Certificate().NotAfter) {
+		t.Errorf("expected expiry %s, got %s", server.Certificate().NotAfter, cert.NotAfter)
+	}
+}
+
+func TestCertRenewBefore(t *testing.T) {
+	t.Setenv("ETCD_CERT_RENEW_DAYS", "45")
+	if got := CertRenewBefore(); got != 45*24*time.Hour {
+		t.Errorf("expected 45 days, got %s", got)
+	}
+
+	for _, days := range []string{"0", "90", "365"} {
+		t.Setenv("ETCD_CERT_RENEW_DAYS", days)
+		if got := CertRenewBefore(); got != defaultCertRenewDays*24*time.Hour {
+			t.Errorf("expected default for %s days, got %s", days, got)
+		}
+	}
+}
+
+func TestCertExpiryWarnBefore(t *testing.T) {
+	t.Setenv("ETCD_CERT_EXPIRY_WARN_DAYS", "7")
+	if got := CertExpiryWarnBefore(); got != 7*24*time.Hour {
+		t.Errorf("expected 7 days, got %s", got)
+	}
+
+	t.Setenv("ETCD_CERT_EXPIRY_WARN_DAYS", "0")
+	if got := CertExpiryWarnBefore(); got != defaultCertExpiryWarnDays*24*time.Hour {
+		t.Errorf("expected default for invalid value, got %s", got)
+	}
+}
@@ -2,6 +2,7 @@ package flyetcd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -14,7 +15,9 @@ import (
 	"time"
 
 	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
 	client "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
 )
 
 type MemberNotFoundError struct {
@@ -30,42 +33,137 @@ type Client struct {
 	*client.Client
 }
 
+// NewClient connects to etcd, logging in as root when a root password is configured. While a
+// root password rotation is in progress, the staged password is tried before the current one.
 func NewClient(endpoints []string) (*Client, error) {
+	return newClient(endpoints, rootPasswords())
+}
+
+func newClient(endpoints []string, passwords []string) (*Client, error) {
 	// If no endpoints are specified use our internal uri.
 	if len(endpoints) == 0 {
-		endpoints = []string{fmt.Sprintf("http://%s.internal:2379", os.Getenv("FLY_APP_NAME"))}
+		endpoints = []string{fmt.Sprintf("%s://%s.internal:2379", clientScheme(), os.Getenv("FLY_APP_NAME"))}
+	}
+
+	tlsConfig, err := clientTLSConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client tls config: %w", err)
 	}
 
 	config := client.Config{
 		Endpoints:         endpoints,
 		DialTimeout:       10 * time.Second,
 		DialKeepAliveTime: 1 * time.Second,
+		TLS:               tlsConfig,
+	}
+
+	if len(passwords) == 0 {
+		c, err := client.New(config)
+		if err != nil {
+			return nil, err
+		}
+		return &Client{c}, nil
 	}
 
-	password := os.Getenv("ETCD_ROOT_PASSWORD")
-	if password != "" {
-		config.Username = "root"
+	var lastErr error
+	for _, password := range passwords {
+		config.Username = rootName
 		config.Password = password
+
+		c, err := client.New(config)
+		if err == nil {
+			return &Client{c}, nil
+		}
+		if !errors.Is(err, rpctypes.ErrAuthFailed) {
+			return nil, err
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// rootPasswords returns the root passwords to try, in order.
+func rootPasswords() []string {
+	var passwords []string
+	for _, key := range []string{"ETCD_ROOT_PASSWORD_NEXT", "ETCD_ROOT_PASSWORD"} {
+		if password := os.Getenv(key); password != "" {
+			passwords = append(passwords, password)
+		}
+	}
+	return passwords
+}
+
+// IsAuthError reports whether err means the client's credentials are no longer accepted, as
+// happens to a long-lived client once the root password has been rotated.
+func IsAuthError(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		switch rpctypes.Error(err) {
+		case rpctypes.ErrAuthFailed, rpctypes.ErrInvalidAuthToken, rpctypes.ErrAuthOldRevision:
+			return true
+		}
+	}
+	return false
+}
+
+// CachedClient holds a client across the iterations of a long-running loop. The client only
+// knows the password it logged in with, so it is dropped once that password stops being
+// accepted and the next Get logs in again with the configured root passwords.
+type CachedClient struct {
+	endpoints []string
+	passwords func() []string
+	client    *Client
+}
+
+// NewCachedClient returns a CachedClient for the given endpoints. It doesn't connect until
+// the first call to Get.
+func NewCachedClient(endpoints []string) *CachedClient {
+	return &CachedClient{endpoints: endpoints, passwords: rootPasswords}
+}
+
+// Get returns the cached client, connecting first if there isn't one.
+func (c *CachedClient) Get() (*Client, error) {
+	if c.client != nil {
+		return c.client, nil
 	}
 
-	c, err := client.New(config)
+	cli, err := newClient(c.endpoints, c.passwords())
 	if err != nil {
 		return nil, err
 	}
+	c.client = cli
+	return cli, nil
+}
+
+// ResetOnAuthError closes and drops the cached client when err is an authentication error.
+func (c *CachedClient) ResetOnAuthError(err error) {
+	if c.client == nil || !IsAuthError(err) {
+		return
+	}
+	log.Printf("[info] etcd credentials were rejected, reconnecting: %v", err)
+	_ = c.client.Close()
+	c.client = nil
+}
 
-	return &Client{c}, nil
+// Close closes the cached client, if any.
+func (c *CachedClient) Close() error {
+	if c.client == nil {
+		return nil
+	}
+	err := c.client.Close()
+	c.client = nil
+	return err
 }
 
-// MemberID returns the ID of the member with the given machineID.
+// MemberID returns the ID of the member with the given machineID. Members that have
+// been added but not yet started are matched by their peer URL.
 func (c *Client) MemberID(ctx context.Context, machineID string) (uint64, error) {
 	resp, err := c.MemberList(ctx)
 	if err != nil {
 		return 0, err
 	}
-	for _, member := range resp.Members {
-		if member.Name == machineID {
-			return member.ID, nil
-		}
+	if member := findMember(resp.Members, NewEndpoint(machineID)); member != nil {
+		return member.ID, nil
 	}
 	return 0, &MemberNotFoundError{Err: fmt.Errorf("no member found with matching machine id: %q", machineID)}
 }
@@ -73,7 +171,7 @@ func (c *Client) MemberID(ctx context.Context, machineID string) (uint64, error)
 func (c *Client) Backup(ctx context.Context, backupPath string) (int64, error) {
 	snapReader, err := c.Snapshot(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to create snapshot: %v", err)
+		return 0, fmt.Errorf("failed to create snapshot: %w", err)
 	}
 	defer func() {
 		_ = snapReader.Close()
@@ -89,12 +187,22 @@ func (c *Client) Backup(ctx context.Context, backupPath string) (int64, error) {
 
 	n, err := io.Copy(backupFile, snapReader)
 	if err != nil {
-		return 0, fmt.Errorf("failed to write snapshot: %v", err)
+		return 0, fmt.Errorf("failed to write snapshot: %w", err)
 	}
 
 	return n, nil
 }
 
+// Revision returns the current revision of the keyspace. A snapshot taken right after is at
+// or beyond this revision.
+func (c *Client) Revision(ctx context.Context) (int64, error) {
+	resp, err := c.Get(ctx, "/", client.WithCountOnly())
+	if err != nil {
+		return 0, fmt.Errorf("failed to get revision: %w", err)
+	}
+	return resp.Header.Revision, nil
+}
+
 // Restore restores the etcd server from a snapshot file.
 // Warning: This will overwrite the current data directory.
 func (c *Client) Restore(ctx context.Context, snapshotPath string) error {
@@ -126,7 +234,7 @@ func (c *Client) Restore(ctx context.Context, snapshotPath string) error {
 		"--data-dir", node.Config.DataDir,
 		"--name", node.Endpoint.Name,
 		"--initial-cluster", node.Config.InitialCluster,
-		"--initial-cluster-token", getMD5Hash(os.Getenv("FLY_APP_NAME")),
+		"--initial-cluster-token", node.Config.InitialClusterToken,
 		"--initial-advertise-peer-urls", node.Endpoint.PeerURL)
 
 	cmd.Stdout = os.Stdout
@@ -186,6 +294,130 @@ func (c *Client) LeaderMember(ctx context.Context) (*etcdserverpb.Member, error)
 	return nil, fmt.Errorf("no leader found")
 }
 
+// TransferLeadership moves leadership to the healthiest follower if the member associated with
+// the specified machineID is the leader. Returns the ID of the new leader, or 0 if the member
+// wasn't the leader.
+func (c *Client) TransferLeadership(ctx context.Context, machineID string) (uint64, error) {
+	isLeader, err := c.IsLeader(ctx, machineID)
+	if err != nil {
+		return 0, err
+	}
+	if !isLeader {
+		return 0, nil
+	}
+
+	target, err := c.healthiestFollower(ctx, machineID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Leadership transfers must be requested from the leader itself.
+	leaderClient, err := NewClient([]string{NewEndpoint(machineID).ClientURL})
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = leaderClient.Close()
+	}()
+
+	if _, err := leaderClient.MoveLeader(ctx, target.ID); err != nil {
+		return 0, fmt.Errorf("failed to move leader to %x: %w", target.ID, err)
+	}
+
+	return target.ID, nil
+}
+
+// healthiestFollower returns the started, voting member with the highest applied index,
+// excluding the member associated with the specified machineID.
+func (c *Client) healthiestFollower(ctx context.Context, machineID string) (*etcdserverpb.Member, error) {
+	resp, err := c.MemberList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		best         *etcdserverpb.Member
+		bestApplied  uint64
+		unhealthyErr error
+	)
+	for _, member := range resp.Members {
+		if member.Name == "" || member.Name == machineID || member.IsLearner || len(member.ClientURLs) == 0 {
+			continue
+		}
+
+		sCtx, cancel := context.WithTimeout(ctx, (5 * time.Second))
+		status, err := c.Status(sCtx, member.ClientURLs[0])
+		cancel()
+		if err != nil {
+			unhealthyErr = err
+			continue
+		}
+		if len(status.Errors) > 0 {
+			continue
+		}
+
+		if best == nil || status.RaftAppliedIndex > bestApplied {
+			best = member
+			bestApplied = status.RaftAppliedIndex
+		}
+	}
+
+	if best == nil {
+		if unhealthyErr != nil {
+			return nil, fmt.Errorf("no healthy follower found: %w", unhealthyErr)
+		}
+		return nil, fmt.Errorf("no healthy follower found")
+	}
+
+	return best, nil
+}
+
+// Lock acquires a cluster-wide lock under the specified key and returns a function that
+// releases it. The lock is bound to a lease, so it's released if this process goes away.
+func (c *Client) Lock(ctx context.Context, key string) (func(), error) {
+	session, err := concurrency.NewSession(c.Client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	mutex := concurrency.NewMutex(session, key)
+	if err := mutex.Lock(ctx); err != nil {
+		_ = session.Close()
+		return nil, fmt.Errorf("failed to acquire lock %s: %w", key, err)
+	}
+
+	return func() {
+		uCtx, cancel := context.WithTimeout(context.Background(), (5 * time.Second))
+		defer cancel()
+		if err := mutex.Unlock(uCtx); err != nil {
+			log.Printf("[warn] failed to release lock %s: %v", key, err)
+		}
+		_ = session.Close()
+	}, nil
+}
+
+// WaitForEndpoint blocks until the member serving the specified client URL responds to status
+// requests without errors.
+func (c *Client) WaitForEndpoint(ctx context.Context, clientURL string) error {
+	tick := time.NewTicker(2 * time.Second)
+	defer tick.Stop()
+
+	for {
+		sCtx, cancel := context.WithTimeout(ctx, (2 * time.Second))
+		status, err := c.Client.Status(sCtx, clientURL)
+		cancel()
+		if err == nil && len(status.Errors) == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for %s: %w", clientURL, ctx.Err())
+		case <-tick.C:
+		}
+	}
+}
+
 // IsLeader returns true if the member associated with the specified machineID is the leader.
 func (c *Client) IsLeader(ctx context.Context, machineID string) (bool, error) {
 	endpoint := NewEndpoint(machineID)
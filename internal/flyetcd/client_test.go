@@ -0,0 +1,125 @@
+package flyetcd
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	client "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// startTestEtcd starts a single member etcd server, named after FLY_MACHINE_ID, and returns its
+// client URL.
+func startTestEtcd(t *testing.T) string {
+	t.Helper()
+
+	cfg := embed.NewConfig()
+	cfg.Name = os.Getenv("FLY_MACHINE_ID")
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+
+	// Members advertise their client URL, so it needs a known port.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to reserve a port: %v", err)
+	}
+	clientURL := url.URL{Scheme: "http", Host: l.Addr().String()}
+	_ = l.Close()
+	peerURL := url.URL{Scheme: "http", Host: "127.0.0.1:0"}
+	cfg.ListenClientUrls = []url.URL{clientURL}
+	cfg.AdvertiseClientUrls = []url.URL{clientURL}
+	cfg.ListenPeerUrls = []url.URL{peerURL}
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("failed to start etcd: %v", err)
+	}
+	t.Cleanup(e.Close)
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		t.Fatal("etcd took too long to start")
+	}
+
+	return clientURL.String()
+}
+
+func TestCachedClientRootRotation(t *testing.T) {
+	setupTestDirs(t)
+	endpoint := startTestEtcd(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), (30 * time.Second))
+	defer cancel()
+
+	// Enable auth with the original root password.
+	admin, err := newClient([]string{endpoint}, nil)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	if err := enableAuth(ctx, admin.Auth, "old-password"); err != nil {
+		t.Fatalf("failed to enable auth: %v", err)
+	}
+	_ = admin.Close()
+
+	t.Setenv("ETCD_ROOT_PASSWORD", "old-password")
+	cached := NewCachedClient([]string{endpoint})
+	defer func() { _ = cached.Close() }()
+
+	live, err := cached.Get()
+	if err != nil {
+		t.Fatalf("failed to connect with the current password: %v", err)
+	}
+	if _, err := live.Put(ctx, "/key", "before"); err != nil {
+		t.Fatalf("put failed before the rotation: %v", err)
+	}
+
+	// Stage the new password and rotate under the live client.
+	t.Setenv("ETCD_ROOT_PASSWORD_NEXT", "new-password")
+	if err := live.RotateRootPassword(ctx, "new-password"); err != nil {
+		t.Fatalf("failed to rotate root password: %v", err)
+	}
+
+	_, err = live.Put(ctx, "/key", "after")
+	if !IsAuthError(err) {
+		t.Fatalf("expected the live client to be rejected after the rotation, got %v", err)
+	}
+
+	cached.ResetOnAuthError(err)
+	rebuilt, err := cached.Get()
+	if err != nil {
+		t.Fatalf("failed to reconnect after the rotation: %v", err)
+	}
+	if rebuilt == live {
+		t.Fatal("expected the rejected client to be replaced")
+	}
+	if _, err := rebuilt.Put(ctx, "/key", "after"); err != nil {
+		t.Fatalf("put failed after reconnecting: %v", err)
+	}
+
+	t.Run("other errors keep the client", func(t *testing.T) {
+		cached.ResetOnAuthError(context.DeadlineExceeded)
+		c, err := cached.Get()
+		if err != nil {
+			t.Fatalf("get failed: %v", err)
+		}
+		if c != rebuilt {
+			t.Error("expected the client to be kept")
+		}
+	})
+
+	t.Run("auth error detection", func(t *testing.T) {
+		_, err := newClient([]string{endpoint}, []string{"wrong"})
+		if !IsAuthError(err) {
+			t.Errorf("expected an auth error, got %v", err)
+		}
+		if IsAuthError(client.ErrNoAvailableEndpoints) {
+			t.Error("expected ErrNoAvailableEndpoints not to be an auth error")
+		}
+	})
+}
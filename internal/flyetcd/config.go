@@ -4,20 +4,25 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 	"strconv"
+	"time"
 
 	yaml "gopkg.in/yaml.v3"
 )
 
 var (
-	DataDir        = "/data"
-	ConfigFilePath = "/data/etcd.yaml"
+	DataDir              = "/data"
+	ConfigFilePath       = "/data/etcd.yaml"
+	BootstrapJournalPath = "/data/bootstrap.yaml"
 )
 
 const (
-	MetricsBaseURL  = "http://[::]:2381"
-	MetricsEndpoint = "http://[::]:2381/metrics"
+	MetricsBaseURL = "http://[::]:2381"
+	// MetricsEndpoint is scraped over loopback, which works no matter which interface metrics
+	// are bound to.
+	MetricsEndpoint = "http://127.0.0.1:2381/metrics"
+	// AdminMetricsEndpoint serves the admin API's own metrics, such as the member reaper's.
+	AdminMetricsEndpoint = "http://127.0.0.1:5500/metrics"
 
 	minBcryptCost     = 4
 	maxBcryptCost     = 31
@@ -48,6 +53,9 @@ type Config struct {
 	MaxWals           int `yaml:"max-wals"`
 	SnapshotCount     int `yaml:"snapshot-count"`
 	QuotaBackendBytes int `yaml:"quota-backend-bytes"`
+
+	ClientTransportSecurity SecurityConfig `yaml:"client-transport-security,omitempty"`
+	PeerTransportSecurity   SecurityConfig `yaml:"peer-transport-security,omitempty"`
 }
 
 func DefaultConfig() *Config {
@@ -55,9 +63,9 @@ func DefaultConfig() *Config {
 
 	return &Config{
 		Name:              endpoint.Name,
-		ListenPeerUrls:    "http://[::]:2380",
-		ListenClientUrls:  "http://[::]:2379",
-		ListenMetricsUrls: MetricsBaseURL,
+		ListenPeerUrls:    fmt.Sprintf("%s://[::]:2380", peerScheme()),
+		ListenClientUrls:  listenClientURLs(),
+		ListenMetricsUrls: MetricsListenURL(),
 
 		// Advertise the DNS name (or ephemeral IP) so other members can connect to it.
 		InitialAdvertisePeerUrls: endpoint.PeerURL,
@@ -102,7 +110,7 @@ func WriteConfig(c *Config) error {
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(ConfigFilePath, data, 0700)
+	return writeFileAtomic(ConfigFilePath, data, 0700)
 }
 
 func (c *Config) SetAuthToken() error {
@@ -112,37 +120,23 @@ func (c *Config) SetAuthToken() error {
 		return nil
 	}
 
-	dir := filepath.Join(c.DataDir, "certs")
-	if err := os.Mkdir(dir, 0700); err != nil {
-		if !os.IsExist(err) {
-			return fmt.Errorf("failed to create jwt cert directory: %w", err)
-		}
+	// Members that have already been moved over to the staged key pair keep using it until
+	// it's promoted.
+	keys := currentJWTKeys()
+	if next := nextJWTKeys(); next != nil && c.usingJWTKeys(next) {
+		keys = next
 	}
 
-	pubCert := os.Getenv("ETCD_JWT_PUBLIC")
-	privCert := os.Getenv("ETCD_JWT_PRIVATE")
-	signMethod := os.Getenv("ETCD_JWT_SIGN_METHOD")
-
-	pubCertPath := filepath.Join(dir, "jwt_token.pub")
-	privCertPath := filepath.Join(dir, "jwt_token")
-
-	if err := os.WriteFile(privCertPath, []byte(privCert), 0644); err != nil {
-		return fmt.Errorf("failed to write private key: %w", err)
+	// The keys are checked strictly before a rotation, but on boot a key etcd would still load
+	// must never stop the member from starting.
+	if err := keys.validate(); err != nil {
+		log.Printf("[warn] JWT keys failed validation, etcd may reject them: %v", err)
 	}
-	if err := os.WriteFile(pubCertPath, []byte(pubCert), 0644); err != nil {
-		return fmt.Errorf("failed to write public key: %w", err)
-	}
-
-	c.AuthToken = fmt.Sprintf("jwt,pub-key=%s,priv-key=%s,sign-method=%s",
-		pubCertPath,
-		privCertPath,
-		signMethod,
-	)
 
-	return nil
+	return c.writeJWTKeys(keys)
 }
 
-func getEnvOrDefault[T string | int](key string, fallback T) T {
+func getEnvOrDefault[T string | int | bool | time.Duration](key string, fallback T) T {
 	val, ok := os.LookupEnv(key)
 	if !ok {
 		return fallback
@@ -159,6 +153,20 @@ func getEnvOrDefault[T string | int](key string, fallback T) T {
 			return fallback
 		}
 		result = n
+	case bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			log.Printf("invalid value for %s, using default: %v", key, err)
+			return fallback
+		}
+		result = b
+	case time.Duration:
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			log.Printf("invalid value for %s, using default: %v", key, err)
+			return fallback
+		}
+		result = d
 	}
 
 	return result.(T)
@@ -168,7 +176,7 @@ func isJWTAuthEnabled() bool {
 	if os.Getenv("ETCD_JWT_PRIVATE") == "" {
 		return false
 	}
-	if os.Getenv("ETCD_JWT_PUBLIC") == "" {
+	if os.Getenv("ETCD_JWT_PUBLIC") == "" && !isHMACSignMethod(os.Getenv("ETCD_JWT_SIGN_METHOD")) {
 		return false
 	}
 	if os.Getenv("ETCD_JWT_SIGN_METHOD") == "" {
@@ -1,14 +1,16 @@
 package flyetcd
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	yaml "gopkg.in/yaml.v3"
 )
 
-// setupTestDirs overrides DataDir and ConfigFilePath to use a temp directory,
+// setupTestDirs overrides DataDir and the paths of the files within it to use a temp directory,
 // and sets the required FLY_* env vars. Returns restore func via t.Cleanup.
 func setupTestDirs(t *testing.T) string {
 	t.Helper()
@@ -16,9 +18,13 @@ func setupTestDirs(t *testing.T) string {
 	tmpDir := t.TempDir()
 	origDataDir := DataDir
 	origConfigFilePath := ConfigFilePath
+	origBootstrapJournalPath := BootstrapJournalPath
+	origClusterIdentityPath := ClusterIdentityPath
 
 	DataDir = tmpDir
 	ConfigFilePath = filepath.Join(tmpDir, "etcd.yaml")
+	BootstrapJournalPath = filepath.Join(tmpDir, "bootstrap.yaml")
+	ClusterIdentityPath = filepath.Join(tmpDir, "cluster-identity.yaml")
 
 	t.Setenv("FLY_MACHINE_ID", "test-machine")
 	t.Setenv("FLY_APP_NAME", "test-app")
@@ -26,6 +32,8 @@ func setupTestDirs(t *testing.T) string {
 	t.Cleanup(func() {
 		DataDir = origDataDir
 		ConfigFilePath = origConfigFilePath
+		BootstrapJournalPath = origBootstrapJournalPath
+		ClusterIdentityPath = origClusterIdentityPath
 	})
 
 	return tmpDir
@@ -82,6 +90,40 @@ func TestGetEnvOrDefault(t *testing.T) {
 		})
 	})
 
+	t.Run("bool", func(t *testing.T) {
+		t.Run("valid", func(t *testing.T) {
+			t.Setenv("ETCD_TEST_BOOL", "true")
+			if result := getEnvOrDefault("ETCD_TEST_BOOL", false); !result {
+				t.Error("expected true, got false")
+			}
+		})
+
+		t.Run("invalid returns fallback", func(t *testing.T) {
+			t.Setenv("ETCD_TEST_BOOL_BAD", "banana")
+			if result := getEnvOrDefault("ETCD_TEST_BOOL_BAD", true); !result {
+				t.Error("expected fallback true, got false")
+			}
+		})
+	})
+
+	t.Run("duration", func(t *testing.T) {
+		t.Run("valid", func(t *testing.T) {
+			t.Setenv("ETCD_TEST_DURATION", "90s")
+			result := getEnvOrDefault("ETCD_TEST_DURATION", time.Minute)
+			if result != 90*time.Second {
+				t.Errorf("expected 90s, got %s", result)
+			}
+		})
+
+		t.Run("invalid returns fallback", func(t *testing.T) {
+			t.Setenv("ETCD_TEST_DURATION_BAD", "banana")
+			result := getEnvOrDefault("ETCD_TEST_DURATION_BAD", time.Minute)
+			if result != time.Minute {
+				t.Errorf("expected fallback 1m, got %s", result)
+			}
+		})
+	})
+
 }
 
 // We want to make sure that defaults are preserved when unmarshalling a partial YAML config.
@@ -548,3 +590,85 @@ func TestEnvOverridesConfigFile(t *testing.T) {
 		t.Errorf("expected max-snapshots 10, got %d", cfg.MaxSnapshots)
 	}
 }
+
+func TestResolveConfigClientURLs(t *testing.T) {
+	write := func(t *testing.T, tmpDir, advertise string) {
+		configYAML := fmt.Sprintf("name: existing-node\nlisten-client-urls: http://0.0.0.0:2379\nadvertise-client-urls: %s\n", advertise)
+		if err := os.WriteFile(filepath.Join(tmpDir, "etcd.yaml"), []byte(configYAML), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+	}
+
+	t.Run("custom advertise url kept", func(t *testing.T) {
+		tmpDir := setupTestDirs(t)
+		write(t, tmpDir, "http://test-app.flycast:2379")
+
+		cfg, err := resolveConfig()
+		if err != nil {
+			t.Fatalf("resolveConfig failed: %v", err)
+		}
+		if cfg.AdvertiseClientUrls != "http://test-app.flycast:2379" {
+			t.Errorf("expected the advertised url to be kept, got %q", cfg.AdvertiseClientUrls)
+		}
+		if cfg.ListenClientUrls != "http://0.0.0.0:2379" {
+			t.Errorf("expected the custom listener to be kept, got %q", cfg.ListenClientUrls)
+		}
+	})
+
+	t.Run("client bind rebinds listener", func(t *testing.T) {
+		tmpDir := setupTestDirs(t)
+		t.Setenv("ETCD_CLIENT_BIND", "all")
+		write(t, tmpDir, "http://test-app.flycast:2379")
+
+		cfg, err := resolveConfig()
+		if err != nil {
+			t.Fatalf("resolveConfig failed: %v", err)
+		}
+		if cfg.ListenClientUrls != "http://[::]:2379" {
+			t.Errorf("expected the listener to follow the bind settings, got %q", cfg.ListenClientUrls)
+		}
+	})
+
+	t.Run("scheme change rewrites advertise url", func(t *testing.T) {
+		tmpDir := setupTestDirs(t)
+		setupTestCA(t)
+		t.Setenv("ETCD_CLIENT_TLS", "true")
+		write(t, tmpDir, "http://test-app.flycast:2379")
+
+		cfg, err := resolveConfig()
+		if err != nil {
+			t.Fatalf("resolveConfig failed: %v", err)
+		}
+		if cfg.AdvertiseClientUrls != "https://test-machine.vm.test-app.internal:2379" {
+			t.Errorf("expected an https advertised url, got %q", cfg.AdvertiseClientUrls)
+		}
+		if cfg.ListenClientUrls != "https://[::]:2379" {
+			t.Errorf("expected an https listener, got %q", cfg.ListenClientUrls)
+		}
+	})
+
+	t.Run("advertise override must match scheme", func(t *testing.T) {
+		tmpDir := setupTestDirs(t)
+		setupTestCA(t)
+		t.Setenv("ETCD_CLIENT_TLS", "true")
+		t.Setenv("ETCD_ADVERTISE_CLIENT_URLS", "http://test-app.flycast:2379")
+		write(t, tmpDir, "https://test-app.flycast:2379")
+
+		cfg, err := resolveConfig()
+		if err != nil {
+			t.Fatalf("resolveConfig failed: %v", err)
+		}
+		if cfg.AdvertiseClientUrls != "https://test-app.flycast:2379" {
+			t.Errorf("expected the http override to be ignored, got %q", cfg.AdvertiseClientUrls)
+		}
+
+		t.Setenv("ETCD_ADVERTISE_CLIENT_URLS", "https://shared.flycast:2379")
+		cfg, err = resolveConfig()
+		if err != nil {
+			t.Fatalf("resolveConfig failed: %v", err)
+		}
+		if cfg.AdvertiseClientUrls != "https://shared.flycast:2379" {
+			t.Errorf("expected the https override to be applied, got %q", cfg.AdvertiseClientUrls)
+		}
+	})
+}
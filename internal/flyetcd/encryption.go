@@ -0,0 +1,316 @@
+package flyetcd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Encrypted backups start with a header holding the ID of the master key and the backup's own
+// data key, wrapped with the master key. The snapshot follows in AES-256-GCM sealed chunks.
+const (
+	envelopeMagic     = "FLYENC01"
+	envelopeChunkSize = 64 * 1024
+	// envelopeHeaderMax bounds the header: magic, key ID length and key ID, wrapped data key.
+	envelopeHeaderMax = len(envelopeMagic) + 1 + 255 + 12 + 32 + 16
+)
+
+// ErrUnknownBackupKey is returned when a backup was encrypted with a key that isn't configured.
+var ErrUnknownBackupKey = errors.New("backup was encrypted with an unknown key")
+
+// BackupKey is a master key used to wrap backup data keys.
+type BackupKey struct {
+	ID  string
+	key []byte
+}
+
+// NewBackupKey parses a base64 encoded 256-bit key. Its ID is derived from the key, so it can
+// be recorded alongside backups without revealing anything about the key.
+func NewBackupKey(encoded string) (BackupKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return BackupKey{}, fmt.Errorf("failed to decode backup encryption key: %w", err)
+	}
+	if len(key) != 32 {
+		return BackupKey{}, fmt.Errorf("backup encryption key must be 32 bytes, got %d", len(key))
+	}
+
+	sum := sha256.Sum256(key)
+	return BackupKey{ID: hex.EncodeToString(sum[:8]), key: key}, nil
+}
+
+// ResolveBackupKeys returns the key new backups are encrypted with, from BACKUP_ENCRYPTION_KEY,
+// followed by the BACKUP_ENCRYPTION_KEY_PREVIOUS keys older backups may still be encrypted
+// with. Returns nil when encryption isn't configured.
+func ResolveBackupKeys() ([]BackupKey, error) {
+	current := os.Getenv("BACKUP_ENCRYPTION_KEY")
+	if current == "" {
+		return nil, nil
+	}
+
+	encoded := []string{current}
+	if previous := os.Getenv("BACKUP_ENCRYPTION_KEY_PREVIOUS"); previous != "" {
+		encoded = append(encoded, strings.Split(previous, ",")...)
+	}
+
+	var keys []BackupKey
+	for _, e := range encoded {
+		key, err := NewBackupKey(e)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// EncryptedStore encrypts backups before handing them to the underlying store, and decrypts
+// them after download. Backups taken before encryption was enabled are downloaded as is.
+type EncryptedStore struct {
+	BackupStore
+	keys []BackupKey
+}
+
+// NewEncryptedStore wraps the store, encrypting new backups with the first key. The remaining
+// keys are only used for decryption.
+func NewEncryptedStore(store BackupStore, keys []BackupKey) (*EncryptedStore, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no backup encryption keys configured")
+	}
+	return &EncryptedStore{BackupStore: store, keys: keys}, nil
+}
+
+func (e *EncryptedStore) Location() string {
+	return fmt.Sprintf("%s (encrypted with key %s)", e.BackupStore.Location(), e.keys[0].ID)
+}
+
+// Upload encrypts the backup as it's streamed to the underlying store, so no plaintext or
+// ciphertext copy is staged on disk.
+func (e *EncryptedStore) Upload(ctx context.Context, r io.Reader, revision int64, _ string) (string, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		_ = pw.CloseWithError(encryptBackup(pw, r, e.keys[0]))
+	}()
+
+	id, err := e.BackupStore.Upload(ctx, pr, revision, e.keys[0].ID)
+	// Unblock the encryption if the upload gave up early.
+	_ = pr.CloseWithError(fmt.Errorf("upload finished"))
+	return id, err
+}
+
+func (e *EncryptedStore) Download(ctx context.Context, directory, id string) (string, error) {
+	downloaded, err := e.BackupStore.Download(ctx, directory, id)
+	if err != nil {
+		return "", err
+	}
+
+	src, err := os.Open(downloaded)
+	if err != nil {
+		return "", fmt.Errorf("failed to open downloaded backup: %w", err)
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+
+	r := bufio.NewReader(src)
+	if magic, err := r.Peek(len(envelopeMagic)); err != nil || string(magic) != envelopeMagic {
+		// Not encrypted
+		return downloaded, nil
+	}
+
+	snapshotPath := filepath.Join(directory, "backup-restore-decrypted.db")
+	dst, err := os.OpenFile(snapshotPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot file: %w", err)
+	}
+	defer func() {
+		_ = dst.Close()
+	}()
+
+	if err := decryptBackup(dst, r, e.keys); err != nil {
+		return "", fmt.Errorf("failed to decrypt backup %s: %w", id, err)
+	}
+
+	return snapshotPath, nil
+}
+
+// encryptBackup writes the envelope header followed by the sealed chunks of src.
+func encryptBackup(dst io.Writer, src io.Reader, key BackupKey) error {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrap, err := newGCM(key.key)
+	if err != nil {
+		return err
+	}
+	wrapNonce := make([]byte, wrap.NonceSize())
+	if _, err := rand.Read(wrapNonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	header := bytes.NewBufferString(envelopeMagic)
+	header.WriteByte(byte(len(key.ID)))
+	header.WriteString(key.ID)
+	header.Write(wrapNonce)
+	header.Write(wrap.Seal(nil, wrapNonce, dataKey, []byte(envelopeMagic+key.ID)))
+	if _, err := dst.Write(header.Bytes()); err != nil {
+		return fmt.Errorf("failed to write encryption header: %w", err)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+
+	r := bufio.NewReaderSize(src, envelopeChunkSize)
+	buf := make([]byte, envelopeChunkSize)
+	for counter := uint64(0); ; counter++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+
+		final := n < envelopeChunkSize
+		if !final {
+			if _, err := r.Peek(1); errors.Is(err, io.EOF) {
+				final = true
+			}
+		}
+
+		if _, err := dst.Write(aead.Seal(nil, chunkNonce(counter, final), buf[:n], nil)); err != nil {
+			return fmt.Errorf("failed to write encrypted backup: %w", err)
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// decryptBackup reads an envelope written by encryptBackup, unwrapping its data key with the
+// matching key, and writes the snapshot to dst.
+func decryptBackup(dst io.Writer, src io.Reader, keys []BackupKey) error {
+	r := bufio.NewReaderSize(src, envelopeChunkSize+16)
+
+	keyID, err := readEnvelopeKeyID(r)
+	if err != nil {
+		return err
+	}
+
+	var key *BackupKey
+	for i := range keys {
+		if keys[i].ID == keyID {
+			key = &keys[i]
+			break
+		}
+	}
+	if key == nil {
+		return fmt.Errorf("%w %s", ErrUnknownBackupKey, keyID)
+	}
+
+	wrap, err := newGCM(key.key)
+	if err != nil {
+		return err
+	}
+	wrapped := make([]byte, wrap.NonceSize()+32+wrap.Overhead())
+	if _, err := io.ReadFull(r, wrapped); err != nil {
+		return fmt.Errorf("failed to read encryption header: %w", err)
+	}
+	dataKey, err := wrap.Open(nil, wrapped[:wrap.NonceSize()], wrapped[wrap.NonceSize():], []byte(envelopeMagic+keyID))
+	if err != nil {
+		return fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, envelopeChunkSize+aead.Overhead())
+	for counter := uint64(0); ; counter++ {
+		n, err := io.ReadFull(r, buf)
+		if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+
+		final := n < len(buf)
+		if !final {
+			if _, err := r.Peek(1); errors.Is(err, io.EOF) {
+				final = true
+			}
+		}
+
+		plaintext, err := aead.Open(nil, chunkNonce(counter, final), buf[:n], nil)
+		if err != nil {
+			return fmt.Errorf("backup is corrupt or truncated: %w", err)
+		}
+		if _, err := dst.Write(plaintext); err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+		if final {
+			return nil
+		}
+	}
+}
+
+// readEnvelopeKeyID reads the envelope magic and key ID. Returns an empty ID when r isn't an
+// encrypted backup.
+func readEnvelopeKeyID(r io.Reader) (string, error) {
+	magic := make([]byte, len(envelopeMagic)+1)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic[:len(envelopeMagic)]) != envelopeMagic {
+		return "", nil
+	}
+
+	keyID := make([]byte, magic[len(envelopeMagic)])
+	if _, err := io.ReadFull(r, keyID); err != nil {
+		return "", fmt.Errorf("failed to read encryption header: %w", err)
+	}
+	return string(keyID), nil
+}
+
+// readBackupKeyID reads the key ID from the header of the backup file. Returns an empty ID when
+// the backup isn't encrypted.
+func readBackupKeyID(backupPath string) (string, error) {
+	file, err := os.Open(backupPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return readEnvelopeKeyID(file)
+}
+
+// chunkNonce derives the nonce of a chunk from its position, so chunks can't be reordered,
+// and marks the final chunk, so truncation is detected.
+func chunkNonce(counter uint64, final bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], counter)
+	if final {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
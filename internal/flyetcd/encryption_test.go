@@ -0,0 +1,213 @@
+package flyetcd
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestBackupKey(t *testing.T) BackupKey {
+	t.Helper()
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	key, err := NewBackupKey(base64.StdEncoding.EncodeToString(raw))
+	if err != nil {
+		t.Fatalf("NewBackupKey failed: %v", err)
+	}
+	return key
+}
+
+func TestEncryptBackup(t *testing.T) {
+	key := newTestBackupKey(t)
+
+	for name, size := range map[string]int{
+		"empty":          0,
+		"partial chunk":  1000,
+		"exact chunk":    envelopeChunkSize,
+		"several chunks": 3*envelopeChunkSize + 17,
+	} {
+		t.Run(name, func(t *testing.T) {
+			plaintext := make([]byte, size)
+			if _, err := rand.Read(plaintext); err != nil {
+				t.Fatalf("failed to generate plaintext: %v", err)
+			}
+
+			var encrypted bytes.Buffer
+			if err := encryptBackup(&encrypted, bytes.NewReader(plaintext), key); err != nil {
+				t.Fatalf("encryptBackup failed: %v", err)
+			}
+			if size > 0 && bytes.Contains(encrypted.Bytes(), plaintext) {
+				t.Fatal("expected the snapshot to be encrypted")
+			}
+
+			keyID, err := readEnvelopeKeyID(bytes.NewReader(encrypted.Bytes()))
+			if err != nil || keyID != key.ID {
+				t.Errorf("expected key ID %s, got %q (%v)", key.ID, keyID, err)
+			}
+
+			var decrypted bytes.Buffer
+			if err := decryptBackup(&decrypted, bytes.NewReader(encrypted.Bytes()), []BackupKey{key}); err != nil {
+				t.Fatalf("decryptBackup failed: %v", err)
+			}
+			if !bytes.Equal(decrypted.Bytes(), plaintext) {
+				t.Error("decrypted snapshot doesn't match")
+			}
+		})
+	}
+
+	t.Run("truncated", func(t *testing.T) {
+		var encrypted bytes.Buffer
+		if err := encryptBackup(&encrypted, bytes.NewReader(make([]byte, 2*envelopeChunkSize+1)), key); err != nil {
+			t.Fatalf("encryptBackup failed: %v", err)
+		}
+
+		// Drop the final chunk, leaving a stream that ends on a chunk boundary
+		truncated := encrypted.Bytes()[:encrypted.Len()-(1+16)]
+		if err := decryptBackup(&bytes.Buffer{}, bytes.NewReader(truncated), []BackupKey{key}); err == nil {
+			t.Error("expected truncation to be detected")
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		var encrypted bytes.Buffer
+		if err := encryptBackup(&encrypted, bytes.NewReader([]byte("snapshot")), key); err != nil {
+			t.Fatalf("encryptBackup failed: %v", err)
+		}
+
+		err := decryptBackup(&bytes.Buffer{}, bytes.NewReader(encrypted.Bytes()), []BackupKey{newTestBackupKey(t)})
+		if !errors.Is(err, ErrUnknownBackupKey) {
+			t.Errorf("expected ErrUnknownBackupKey, got %v", err)
+		}
+	})
+
+	t.Run("unencrypted", func(t *testing.T) {
+		keyID, err := readEnvelopeKeyID(bytes.NewReader([]byte("plain snapshot")))
+		if err != nil || keyID != "" {
+			t.Errorf("expected no key ID, got %q (%v)", keyID, err)
+		}
+	})
+}
+
+func TestResolveBackupKeys(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		keys, err := ResolveBackupKeys()
+		if err != nil || keys != nil {
+			t.Errorf("expected no keys, got %v (%v)", keys, err)
+		}
+	})
+
+	t.Run("current and previous", func(t *testing.T) {
+		current := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+		previous := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+		t.Setenv("BACKUP_ENCRYPTION_KEY", current)
+		t.Setenv("BACKUP_ENCRYPTION_KEY_PREVIOUS", previous)
+
+		keys, err := ResolveBackupKeys()
+		if err != nil {
+			t.Fatalf("ResolveBackupKeys failed: %v", err)
+		}
+		if len(keys) != 2 || keys[0].ID == keys[1].ID || len(keys[0].ID) != 16 {
+			t.Errorf("unexpected keys %v", keys)
+		}
+	})
+
+	t.Run("invalid length", func(t *testing.T) {
+		t.Setenv("BACKUP_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString([]byte("short")))
+		if _, err := ResolveBackupKeys(); err == nil {
+			t.Error("expected an error for a short key")
+		}
+	})
+}
+
+func TestEncryptedStore(t *testing.T) {
+	ctx := context.Background()
+
+	files, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+
+	snapshot := filepath.Join(t.TempDir(), "snapshot.db")
+	if err := os.WriteFile(snapshot, []byte("snapshot contents"), 0600); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+
+	// A backup taken before encryption was enabled
+	plainID, err := UploadBackup(ctx, files, snapshot, 1)
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+
+	key := newTestBackupKey(t)
+	store, err := NewEncryptedStore(files, []BackupKey{key})
+	if err != nil {
+		t.Fatalf("NewEncryptedStore failed: %v", err)
+	}
+
+	// Keys have second precision
+	time.Sleep(1100 * time.Millisecond)
+
+	id, err := UploadBackup(ctx, store, snapshot, 2)
+	if err != nil {
+		t.Fatalf("upload failed: %v", err)
+	}
+
+	t.Run("stored encrypted", func(t *testing.T) {
+		data, err := os.ReadFile(filepath.Join(files.root, filepath.FromSlash(id)))
+		if err != nil {
+			t.Fatalf("failed to read stored backup: %v", err)
+		}
+		if bytes.Contains(data, []byte("snapshot contents")) {
+			t.Error("expected the stored backup to be encrypted")
+		}
+	})
+
+	t.Run("list records key id", func(t *testing.T) {
+		versions, err := store.List(ctx)
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		if len(versions) != 2 {
+			t.Fatalf("expected 2 backups, got %d", len(versions))
+		}
+		if versions[0].VersionID != id || versions[0].KeyID != key.ID {
+			t.Errorf("expected %s to be encrypted with %s, got %+v", id, key.ID, versions[0])
+		}
+		if versions[1].VersionID != plainID || versions[1].KeyID != "" {
+			t.Errorf("expected %s to be unencrypted, got %+v", plainID, versions[1])
+		}
+	})
+
+	t.Run("fetch without key", func(t *testing.T) {
+		_, err := FetchBackup(ctx, files, t.TempDir(), id)
+		if err == nil || !strings.Contains(err.Error(), "BACKUP_ENCRYPTION_KEY") {
+			t.Errorf("expected an error asking for the encryption key, got %v", err)
+		}
+	})
+
+	t.Run("download decrypts", func(t *testing.T) {
+		for _, backupID := range []string{id, plainID} {
+			path, err := store.Download(ctx, t.TempDir(), backupID)
+			if err != nil {
+				t.Fatalf("download failed: %v", err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read download: %v", err)
+			}
+			if string(data) != "snapshot contents" {
+				t.Errorf("unexpected contents %q for %s", data, backupID)
+			}
+		}
+	})
+}
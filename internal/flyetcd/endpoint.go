@@ -3,7 +3,9 @@ package flyetcd
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
 
 	"github.com/fly-apps/fly-etcd/internal/privnet"
 )
@@ -13,6 +15,7 @@ type Endpoint struct {
 	Addr      string
 	ClientURL string
 	PeerURL   string
+	AdminURL  string
 }
 
 // NewEndpoint returns a new Endpoint for a given machine ID.
@@ -29,11 +32,26 @@ func NewEndpoint(machineID string) *Endpoint {
 	return &Endpoint{
 		Name:      machineID,
 		Addr:      addr,
-		ClientURL: fmt.Sprintf("http://%s:2379", addr),
-		PeerURL:   fmt.Sprintf("http://%s:2380", addr),
+		ClientURL: fmt.Sprintf("%s://%s:2379", clientScheme(), addr),
+		PeerURL:   fmt.Sprintf("%s://%s:2380", peerScheme(), addr),
+		AdminURL:  fmt.Sprintf("http://%s:5500", addr),
 	}
 }
 
+// machineIDFromPeerURL extracts the machine ID from a peer URL generated by NewEndpoint.
+// Returns an empty string for any other URL.
+func machineIDFromPeerURL(peerURL string) string {
+	u, err := url.Parse(peerURL)
+	if err != nil {
+		return ""
+	}
+	id, domain, _ := strings.Cut(u.Hostname(), ".")
+	if id == "" || domain != fmt.Sprintf("vm.%s.internal", os.Getenv("FLY_APP_NAME")) {
+		return ""
+	}
+	return id
+}
+
 // AllEndpoints uses DNS to return all Machines associated with the app.
 func AllEndpoints(ctx context.Context) ([]*Endpoint, error) {
 	machines, err := privnet.AllMachines(ctx, os.Getenv("FLY_APP_NAME"))
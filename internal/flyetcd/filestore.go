@@ -0,0 +1,234 @@
+package flyetcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// FileStore stores backups in a directory, such as a second volume or an NFS mount, using the
+// <yyyy>/<mm>/<timestamp>-<rev>.db layout.
+type FileStore struct {
+	root string
+}
+
+func NewFileStore(root string) (*FileStore, error) {
+	if err := os.MkdirAll(root, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return &FileStore{root: root}, nil
+}
+
+// newFileBackupStore opens the store for file:///<path>.
+func newFileBackupStore(_ context.Context, u *url.URL) (BackupStore, error) {
+	if u.Host != "" || u.Path == "" {
+		return nil, fmt.Errorf("file backup url must be of the form file:///<path>")
+	}
+	return NewFileStore(u.Path)
+}
+
+func (f *FileStore) Location() string {
+	return "file://" + f.root
+}
+
+// Upload copies the backup into the store. The copy is renamed into place once complete, so
+// partial backups are never listed. The key ID is read back from the backup's header.
+func (f *FileStore) Upload(_ context.Context, src io.Reader, revision int64, _ string) (string, error) {
+	id := backupKey(time.Now(), revision)
+	dst := filepath.Join(f.root, filepath.FromSlash(id))
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".tmp-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := io.Copy(tmp, src); err != nil {
+		_ = tmp.Close()
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return "", fmt.Errorf("failed to sync backup: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return "", fmt.Errorf("failed to store backup: %w", err)
+	}
+
+	return id, nil
+}
+
+func (f *FileStore) Download(_ context.Context, directory, id string) (string, error) {
+	src, err := f.path(id)
+	if err != nil {
+		return "", err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", ErrBackupNotFound
+		}
+		return "", fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	snapshotPath := filepath.Join(directory, "backup-restore.db")
+	out, err := os.Create(snapshotPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot file: %v", err)
+	}
+	defer func() {
+		_ = out.Close()
+	}()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return "", fmt.Errorf("failed to write snapshot: %v", err)
+	}
+
+	return snapshotPath, nil
+}
+
+func (f *FileStore) List(_ context.Context) ([]BackupVersion, error) {
+	var versions []BackupVersion
+	err := filepath.WalkDir(f.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(f.root, p)
+		if err != nil {
+			return err
+		}
+		id := filepath.ToSlash(rel)
+		_, revision, ok := parseBackupKey(id)
+		if !ok {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		// Reading the header is cheap locally, but a backup that can't be read shouldn't hide
+		// the rest.
+		keyID, err := readBackupKeyID(p)
+		if err != nil {
+			log.Printf("[warn] failed to read key id of backup %s: %v", id, err)
+		}
+
+		versions = append(versions, BackupVersion{
+			VersionID:    id,
+			LastModified: info.ModTime(),
+			Size:         info.Size(),
+			Revision:     revision,
+			KeyID:        keyID,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	// Keys sort chronologically, newest first
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].VersionID > versions[j].VersionID
+	})
+	if len(versions) > 0 {
+		versions[0].IsLatest = true
+	}
+
+	return versions, nil
+}
+
+func (f *FileStore) Latest(ctx context.Context) (BackupVersion, error) {
+	versions, err := f.List(ctx)
+	if err != nil {
+		return BackupVersion{}, err
+	}
+	if len(versions) == 0 {
+		return BackupVersion{}, ErrBackupNotFound
+	}
+	return versions[0], nil
+}
+
+func (f *FileStore) Delete(_ context.Context, id string) error {
+	p, err := f.path(id)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrBackupNotFound
+		}
+		return fmt.Errorf("failed to delete backup %s: %w", id, err)
+	}
+
+	return nil
+}
+
+// Metadata describes the specified backup. IsLatest is not populated.
+func (f *FileStore) Metadata(_ context.Context, id string) (BackupVersion, error) {
+	p, err := f.path(id)
+	if err != nil {
+		return BackupVersion{}, err
+	}
+
+	file, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return BackupVersion{}, ErrBackupNotFound
+		}
+		return BackupVersion{}, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return BackupVersion{}, fmt.Errorf("failed to stat backup: %w", err)
+	}
+
+	keyID, err := readEnvelopeKeyID(file)
+	if err != nil {
+		return BackupVersion{}, err
+	}
+
+	_, revision, _ := parseBackupKey(id)
+	return BackupVersion{
+		VersionID:    id,
+		LastModified: info.ModTime(),
+		Size:         info.Size(),
+		Revision:     revision,
+		KeyID:        keyID,
+	}, nil
+}
+
+// path resolves a backup ID to its file, rejecting anything that isn't a backup key.
+func (f *FileStore) path(id string) (string, error) {
+	if _, _, ok := parseBackupKey(id); !ok {
+		return "", fmt.Errorf("invalid backup id %q", id)
+	}
+	return filepath.Join(f.root, filepath.FromSlash(id)), nil
+}
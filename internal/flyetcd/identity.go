@@ -0,0 +1,301 @@
+package flyetcd
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	yaml "gopkg.in/yaml.v3"
+)
+
+var ClusterIdentityPath = "/data/cluster-identity.yaml"
+
+// ClusterIdentityKey is the well-known key the cluster identity is recorded under.
+const ClusterIdentityKey = "/fly-etcd/cluster-identity"
+
+// identityPublishTimeout bounds how long joiners wait for a new cluster to publish its identity.
+var identityPublishTimeout = 2 * time.Minute
+
+// ClusterIdentity uniquely identifies a cluster across app renames, re-creations and restores.
+type ClusterIdentity struct {
+	ClusterID string    `yaml:"cluster-id,omitempty" json:"cluster_id"`
+	Token     string    `yaml:"token" json:"token"`
+	AppName   string    `yaml:"app-name" json:"app_name"`
+	CreatedAt time.Time `yaml:"created-at" json:"created_at"`
+}
+
+// newClusterToken generates a unique initial cluster token for a cluster formed by a seed.
+func newClusterToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate cluster token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// staticClusterToken derives the initial cluster token from the initial members. Every initial
+// member must agree on the token, and machine IDs are never reused, so the token is unique.
+func staticClusterToken(machineIDs []string) string {
+	sum := sha256.Sum256([]byte(os.Getenv("FLY_APP_NAME") + "/" + strings.Join(machineIDs, ",")))
+	return hex.EncodeToString(sum[:16])
+}
+
+func readClusterIdentity() (*ClusterIdentity, error) {
+	data, err := os.ReadFile(ClusterIdentityPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read cluster identity: %w", err)
+	}
+
+	var identity ClusterIdentity
+	if err := yaml.Unmarshal(data, &identity); err != nil {
+		return nil, fmt.Errorf("failed to parse cluster identity: %w", err)
+	}
+
+	return &identity, nil
+}
+
+func writeClusterIdentity(identity *ClusterIdentity) error {
+	data, err := yaml.Marshal(identity)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(ClusterIdentityPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write cluster identity: %w", err)
+	}
+	return nil
+}
+
+// initializeClusterIdentity assigns the token for a new cluster and persists it. The cluster ID
+// is assigned by etcd, so it's recorded once etcd has started.
+func (n *Node) initializeClusterIdentity(token string) error {
+	n.Config.InitialClusterToken = token
+	return writeClusterIdentity(&ClusterIdentity{
+		Token:     token,
+		AppName:   n.AppName,
+		CreatedAt: time.Now().UTC(),
+	})
+}
+
+// RecordClusterIdentity records the cluster ID assigned by etcd within /data and publishes the
+// identity under the well-known key if it hasn't been already. The identity is only published
+// if the key is unchanged since it was read, so racing members adopt whichever identity was
+// published first rather than overwriting it.
+func (n *Node) RecordClusterIdentity(ctx context.Context, client *Client) (*ClusterIdentity, error) {
+	status, err := client.Status(ctx, n.Endpoint.ClientURL)
+	if err != nil {
+		return nil, err
+	}
+	clusterID := formatClusterID(status.Header.ClusterId)
+
+	published, modRevision, err := client.clusterIdentity(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, err := readClusterIdentity()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case published != nil && published.ClusterID == clusterID:
+		identity = published
+	case identity == nil:
+		identity = &ClusterIdentity{
+			Token:     n.Config.InitialClusterToken,
+			AppName:   n.AppName,
+			CreatedAt: time.Now().UTC(),
+		}
+	}
+	identity.ClusterID = clusterID
+
+	if published == nil || published.ClusterID != clusterID {
+		identity, err = client.publishClusterIdentity(ctx, identity, modRevision)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writeClusterIdentity(identity); err != nil {
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+// publishClusterIdentity publishes the identity, provided the key hasn't been modified since
+// modRevision, which is zero when it didn't exist. Returns the identity that ended up published.
+func (c *Client) publishClusterIdentity(ctx context.Context, identity *ClusterIdentity, modRevision int64) (*ClusterIdentity, error) {
+	data, err := json.Marshal(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	cmp := clientv3.Compare(clientv3.CreateRevision(ClusterIdentityKey), "=", 0)
+	if modRevision != 0 {
+		cmp = clientv3.Compare(clientv3.ModRevision(ClusterIdentityKey), "=", modRevision)
+	}
+
+	resp, err := c.Txn(ctx).
+		If(cmp).
+		Then(clientv3.OpPut(ClusterIdentityKey, string(data))).
+		Else(clientv3.OpGet(ClusterIdentityKey)).
+		Commit()
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish cluster identity: %w", err)
+	}
+	if resp.Succeeded {
+		return identity, nil
+	}
+
+	// Another member published first
+	kvs := resp.Responses[0].GetResponseRange().Kvs
+	if len(kvs) == 0 {
+		return nil, fmt.Errorf("cluster identity was removed while publishing")
+	}
+	var existing ClusterIdentity
+	if err := json.Unmarshal(kvs[0].Value, &existing); err != nil {
+		return nil, fmt.Errorf("failed to parse cluster identity: %w", err)
+	}
+	if existing.ClusterID != identity.ClusterID {
+		return nil, fmt.Errorf("cluster identity was concurrently published for cluster %s", existing.ClusterID)
+	}
+
+	return &existing, nil
+}
+
+// ClusterIdentity returns the identity published under the well-known key, or nil if it
+// hasn't been published.
+func (c *Client) ClusterIdentity(ctx context.Context) (*ClusterIdentity, error) {
+	identity, _, err := c.clusterIdentity(ctx)
+	return identity, err
+}
+
+// clusterIdentity reads the published identity along with the revision it was last modified at.
+func (c *Client) clusterIdentity(ctx context.Context) (*ClusterIdentity, int64, error) {
+	resp, err := c.Get(ctx, ClusterIdentityKey)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get cluster identity: %w", err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, nil
+	}
+
+	var identity ClusterIdentity
+	if err := json.Unmarshal(resp.Kvs[0].Value, &identity); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse cluster identity: %w", err)
+	}
+
+	return &identity, resp.Kvs[0].ModRevision, nil
+}
+
+// verifyClusterIdentity ensures the cluster we reached is the one we expect to join before
+// membership is changed. A freshly formed cluster may not have published its identity yet,
+// so it's waited for, but joining is refused if it never shows up.
+func verifyClusterIdentity(ctx context.Context, client *Client, appName string) error {
+	mCtx, cancel := context.WithTimeout(ctx, (5 * time.Second))
+	resp, err := client.MemberList(mCtx)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	local, err := readClusterIdentity()
+	if err != nil {
+		return err
+	}
+
+	if err := checkClusterIdentity(resp.Header.ClusterId, os.Getenv("ETCD_CLUSTER_ID"), local); err != nil {
+		return err
+	}
+
+	published, err := waitForClusterIdentity(ctx, client)
+	if err != nil {
+		return err
+	}
+
+	return checkPublishedIdentity(published, appName, os.Getenv("ETCD_CLUSTER_TOKEN"), local)
+}
+
+func waitForClusterIdentity(ctx context.Context, client *Client) (*ClusterIdentity, error) {
+	timeout := time.After(identityPublishTimeout)
+	tick := time.NewTicker(2 * time.Second)
+	defer tick.Stop()
+
+	for {
+		gCtx, cancel := context.WithTimeout(ctx, (5 * time.Second))
+		published, err := client.ClusterIdentity(gCtx)
+		cancel()
+		if err == nil && published != nil {
+			return published, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout:
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("cluster has not published its identity under %s", ClusterIdentityKey)
+		case <-tick.C:
+		}
+	}
+}
+
+// checkClusterIdentity compares the reached cluster against the identity pinned through
+// ETCD_CLUSTER_ID and the identity recorded on the volume.
+func checkClusterIdentity(reached uint64, pinned string, local *ClusterIdentity) error {
+	if pinned != "" {
+		expected, err := strconv.ParseUint(pinned, 16, 64)
+		if err != nil {
+			return fmt.Errorf("invalid ETCD_CLUSTER_ID %q: %w", pinned, err)
+		}
+		if reached != expected {
+			return fmt.Errorf("reached cluster %s, but ETCD_CLUSTER_ID is pinned to %s", formatClusterID(reached), pinned)
+		}
+	}
+
+	if local != nil && local.ClusterID != "" && local.ClusterID != formatClusterID(reached) {
+		return fmt.Errorf("reached cluster %s, but this volume belongs to cluster %s", formatClusterID(reached), local.ClusterID)
+	}
+
+	return nil
+}
+
+// checkPublishedIdentity compares the identity the reached cluster published against this
+// app, the token pinned through ETCD_CLUSTER_TOKEN and the token recorded on the volume.
+func checkPublishedIdentity(published *ClusterIdentity, appName, pinnedToken string, local *ClusterIdentity) error {
+	if published == nil {
+		return fmt.Errorf("cluster has not published its identity under %s", ClusterIdentityKey)
+	}
+
+	if published.AppName != appName {
+		return fmt.Errorf("reached a cluster belonging to app %s", published.AppName)
+	}
+
+	if pinnedToken != "" && published.Token != pinnedToken {
+		return fmt.Errorf("reached cluster with token %s, but ETCD_CLUSTER_TOKEN is pinned to %s", published.Token, pinnedToken)
+	}
+
+	if local != nil && local.Token != "" && published.Token != local.Token {
+		return fmt.Errorf("reached cluster with token %s, but this volume belongs to a cluster with token %s", published.Token, local.Token)
+	}
+
+	return nil
+}
+
+func formatClusterID(id uint64) string {
+	return fmt.Sprintf("%x", id)
+}
@@ -0,0 +1,123 @@
+package flyetcd
+
+import (
+	"testing"
+)
+
+func TestCheckClusterIdentity(t *testing.T) {
+	const reached = 0xcdf818194e3a8c32
+
+	t.Run("no expectations", func(t *testing.T) {
+		if err := checkClusterIdentity(reached, "", nil); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("pinned match", func(t *testing.T) {
+		if err := checkClusterIdentity(reached, "cdf818194e3a8c32", nil); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("pinned mismatch", func(t *testing.T) {
+		if err := checkClusterIdentity(reached, "1c2a3b4d5e6f7a8b", nil); err == nil {
+			t.Error("expected error for mismatched pinned cluster id")
+		}
+	})
+
+	t.Run("invalid pin", func(t *testing.T) {
+		if err := checkClusterIdentity(reached, "banana", nil); err == nil {
+			t.Error("expected error for invalid pinned cluster id")
+		}
+	})
+
+	t.Run("volume from another cluster", func(t *testing.T) {
+		local := &ClusterIdentity{ClusterID: "1c2a3b4d5e6f7a8b"}
+		if err := checkClusterIdentity(reached, "", local); err == nil {
+			t.Error("expected error for volume belonging to another cluster")
+		}
+	})
+
+	t.Run("volume without a recorded cluster id", func(t *testing.T) {
+		local := &ClusterIdentity{Token: "abc"}
+		if err := checkClusterIdentity(reached, "", local); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+}
+
+func TestCheckPublishedIdentity(t *testing.T) {
+	published := &ClusterIdentity{ClusterID: "cdf818194e3a8c32", Token: "abc", AppName: "my-etcd"}
+
+	t.Run("matching app", func(t *testing.T) {
+		if err := checkPublishedIdentity(published, "my-etcd", "", nil); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("not published", func(t *testing.T) {
+		if err := checkPublishedIdentity(nil, "my-etcd", "", nil); err == nil {
+			t.Error("expected an error when the identity hasn't been published")
+		}
+	})
+
+	t.Run("different app", func(t *testing.T) {
+		if err := checkPublishedIdentity(published, "other-etcd", "", nil); err == nil {
+			t.Error("expected an error for a cluster belonging to another app")
+		}
+	})
+
+	t.Run("pinned token", func(t *testing.T) {
+		if err := checkPublishedIdentity(published, "my-etcd", "abc", nil); err != nil {
+			t.Errorf("expected no error, got %v", err)
+		}
+		if err := checkPublishedIdentity(published, "my-etcd", "def", nil); err == nil {
+			t.Error("expected an error for a mismatched pinned token")
+		}
+	})
+
+	t.Run("volume token", func(t *testing.T) {
+		if err := checkPublishedIdentity(published, "my-etcd", "", &ClusterIdentity{Token: "def"}); err == nil {
+			t.Error("expected an error for a mismatched volume token")
+		}
+	})
+}
+
+func TestStaticClusterToken(t *testing.T) {
+	t.Setenv("FLY_APP_NAME", "test-app")
+
+	a := staticClusterToken([]string{"148e21da", "3d8d9e0a", "5a2b7c11"})
+	b := staticClusterToken([]string{"148e21da", "3d8d9e0a", "5a2b7c11"})
+	if a != b {
+		t.Errorf("expected initial members to agree on the token, got %q and %q", a, b)
+	}
+
+	c := staticClusterToken([]string{"148e21da", "3d8d9e0a", "9185e73f"})
+	if a == c {
+		t.Error("expected different initial members to produce a different token")
+	}
+}
+
+func TestClusterIdentityFile(t *testing.T) {
+	setupTestDirs(t)
+
+	identity, err := readClusterIdentity()
+	if err != nil {
+		t.Fatalf("readClusterIdentity failed: %v", err)
+	}
+	if identity != nil {
+		t.Fatalf("expected no identity, got %+v", identity)
+	}
+
+	if err := writeClusterIdentity(&ClusterIdentity{ClusterID: "cdf818194e3a8c32", Token: "abc"}); err != nil {
+		t.Fatalf("writeClusterIdentity failed: %v", err)
+	}
+
+	identity, err = readClusterIdentity()
+	if err != nil {
+		t.Fatalf("readClusterIdentity failed: %v", err)
+	}
+	if identity.ClusterID != "cdf818194e3a8c32" || identity.Token != "abc" {
+		t.Errorf("unexpected identity: %+v", identity)
+	}
+}
@@ -0,0 +1,72 @@
+package flyetcd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+type BootstrapState string
+
+const (
+	// BootstrapStateDiscovered indicates the bootstrap seed has been elected.
+	BootstrapStateDiscovered BootstrapState = "discovered"
+	// BootstrapStateMemberAdded indicates this machine has been registered with the cluster.
+	BootstrapStateMemberAdded BootstrapState = "member-added"
+	// BootstrapStateConfigWritten indicates the etcd configuration file has been written.
+	BootstrapStateConfigWritten BootstrapState = "config-written"
+)
+
+// BootstrapJournal records bootstrap progress, so a crash between steps is resumed from the
+// last completed step on the next boot instead of starting over.
+type BootstrapJournal struct {
+	State     BootstrapState `yaml:"state"`
+	Seed      string         `yaml:"seed,omitempty"`
+	MemberID  uint64         `yaml:"member-id,omitempty"`
+	UpdatedAt time.Time      `yaml:"updated-at"`
+
+	// Founder is set when this machine was one of the members that formed the cluster.
+	Founder bool `yaml:"founder,omitempty"`
+	// AuthEnabled is set once the founder has enabled authentication.
+	AuthEnabled bool `yaml:"auth-enabled,omitempty"`
+}
+
+func readBootstrapJournal() (*BootstrapJournal, error) {
+	data, err := os.ReadFile(BootstrapJournalPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &BootstrapJournal{}, nil
+		}
+		return nil, fmt.Errorf("failed to read bootstrap journal: %w", err)
+	}
+
+	var journal BootstrapJournal
+	if err := yaml.Unmarshal(data, &journal); err != nil {
+		return nil, fmt.Errorf("failed to parse bootstrap journal: %w", err)
+	}
+
+	return &journal, nil
+}
+
+// advance records the completion of a bootstrap step.
+func (j *BootstrapJournal) advance(state BootstrapState) error {
+	j.State = state
+	return j.save()
+}
+
+func (j *BootstrapJournal) save() error {
+	j.UpdatedAt = time.Now().UTC()
+
+	data, err := yaml.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(BootstrapJournalPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write bootstrap journal: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package flyetcd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// jwtKeys is a key pair used by etcd to sign and verify auth tokens.
+type jwtKeys struct {
+	Private    string
+	Public     string
+	SignMethod string
+}
+
+func currentJWTKeys() *jwtKeys {
+	return &jwtKeys{
+		Private:    os.Getenv("ETCD_JWT_PRIVATE"),
+		Public:     os.Getenv("ETCD_JWT_PUBLIC"),
+		SignMethod: os.Getenv("ETCD_JWT_SIGN_METHOD"),
+	}
+}
+
+// nextJWTKeys returns the key pair staged for rotation, or nil if none is staged. The sign method
+// carries over from the current keys unless ETCD_JWT_SIGN_METHOD_NEXT is set.
+func nextJWTKeys() *jwtKeys {
+	private, public := os.Getenv("ETCD_JWT_PRIVATE_NEXT"), os.Getenv("ETCD_JWT_PUBLIC_NEXT")
+	method := getEnvOrDefault("ETCD_JWT_SIGN_METHOD_NEXT", os.Getenv("ETCD_JWT_SIGN_METHOD"))
+	if private == "" || (public == "" && !isHMACSignMethod(method)) {
+		return nil
+	}
+	return &jwtKeys{
+		Private:    private,
+		Public:     public,
+		SignMethod: method,
+	}
+}
+
+// isHMACSignMethod reports whether the sign method uses a shared secret rather than a key pair.
+func isHMACSignMethod(method string) bool {
+	_, ok := jwt.GetSigningMethod(method).(*jwt.SigningMethodHMAC)
+	return ok
+}
+
+// ValidateNextJWTKeys verifies the staged key pair before any member is moved over to it.
+func ValidateNextJWTKeys() error {
+	next := nextJWTKeys()
+	if next == nil {
+		return fmt.Errorf("ETCD_JWT_PRIVATE_NEXT and ETCD_JWT_PUBLIC_NEXT must be set")
+	}
+	return next.validate()
+}
+
+// validate loads the key pair the way etcd does for the sign method, so a bad secret is reported
+// before etcd is pointed at it. It is stricter than etcd in two ways: the public key must belong
+// to the private key, and ECDSA keys must be on the curve the sign method signs with.
+func (k *jwtKeys) validate() error {
+	switch method := jwt.GetSigningMethod(k.SignMethod).(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		private, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(k.Private))
+		if err != nil {
+			return fmt.Errorf("invalid jwt private key for sign method %s: %w", k.SignMethod, err)
+		}
+		public, err := jwt.ParseRSAPublicKeyFromPEM([]byte(k.Public))
+		if err != nil {
+			return fmt.Errorf("invalid jwt public key for sign method %s: %w", k.SignMethod, err)
+		}
+		if !private.PublicKey.Equal(public) {
+			return fmt.Errorf("jwt public key does not match the private key")
+		}
+		return nil
+	case *jwt.SigningMethodECDSA:
+		private, err := jwt.ParseECPrivateKeyFromPEM([]byte(k.Private))
+		if err != nil {
+			return fmt.Errorf("invalid jwt private key for sign method %s: %w", k.SignMethod, err)
+		}
+		public, err := jwt.ParseECPublicKeyFromPEM([]byte(k.Public))
+		if err != nil {
+			return fmt.Errorf("invalid jwt public key for sign method %s: %w", k.SignMethod, err)
+		}
+		if curve := private.Curve.Params(); curve.BitSize != method.CurveBits {
+			return fmt.Errorf("sign method %s requires a %d-bit curve, got %s", k.SignMethod, method.CurveBits, curve.Name)
+		}
+		if !private.PublicKey.Equal(public) {
+			return fmt.Errorf("jwt public key does not match the private key")
+		}
+		return nil
+	case *jwt.SigningMethodHMAC:
+		// The private key is used as the shared secret, there is no public key to check.
+		if k.Private == "" {
+			return fmt.Errorf("sign method %s requires a shared secret in the private key", k.SignMethod)
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported jwt sign method %q", k.SignMethod)
+}
+
+// writeJWTKeys writes the key pair and points the auth token at it.
+func (c *Config) writeJWTKeys(keys *jwtKeys) error {
+	dir := filepath.Join(c.DataDir, "certs")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create jwt cert directory: %w", err)
+	}
+
+	pubCertPath := filepath.Join(dir, "jwt_token.pub")
+	privCertPath := filepath.Join(dir, "jwt_token")
+
+	if err := writeFileAtomic(privCertPath, []byte(keys.Private), 0600); err != nil {
+		return fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := writeFileAtomic(pubCertPath, []byte(keys.Public), 0644); err != nil {
+		return fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	c.AuthToken = fmt.Sprintf("jwt,pub-key=%s,priv-key=%s,sign-method=%s",
+		pubCertPath,
+		privCertPath,
+		keys.SignMethod,
+	)
+
+	return nil
+}
+
+// usingJWTKeys reports whether etcd is currently configured with the key pair. HMAC keys have
+// no public key, so the shared secret is compared instead.
+func (c *Config) usingJWTKeys(keys *jwtKeys) bool {
+	name, want := "jwt_token.pub", keys.Public
+	if isHMACSignMethod(keys.SignMethod) {
+		name, want = "jwt_token", keys.Private
+	}
+	data, err := os.ReadFile(filepath.Join(c.DataDir, "certs", name))
+	return err == nil && string(data) == want
+}
+
+// ApplyNextJWTKeys validates the staged key pair and moves this member over to it. Etcd must be
+// restarted to pick it up.
+//
+// The rotation has no overlap window. Etcd verifies tokens against the single public key it was
+// started with, so a member can't trust both key pairs at once: tokens issued before the switch,
+// or by members that haven't switched yet, are rejected and clients must re-authenticate.
+func (c *Config) ApplyNextJWTKeys() error {
+	next := nextJWTKeys()
+	if next == nil {
+		return fmt.Errorf("no jwt key pair is staged")
+	}
+	if err := next.validate(); err != nil {
+		return err
+	}
+	return c.writeJWTKeys(next)
+}
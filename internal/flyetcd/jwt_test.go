@@ -0,0 +1,205 @@
+package flyetcd
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func encodeTestKeyPair(t *testing.T, key crypto.Signer) (string, string) {
+	t.Helper()
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal private key: %v", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %v", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}))
+}
+
+func TestJWTKeysValidate(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ecdsa key: %v", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ecdsa key: %v", err)
+	}
+
+	rsaPriv, rsaPub := encodeTestKeyPair(t, rsaKey)
+	ecPriv, ecPub := encodeTestKeyPair(t, ecKey)
+	_, otherPub := encodeTestKeyPair(t, otherKey)
+
+	// Etcd also loads PKCS#1 and SEC 1 private keys, and public keys wrapped in a certificate.
+	rsaPKCS1Priv := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}))
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("failed to marshal ecdsa key: %v", err)
+	}
+	ecSEC1Priv := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}))
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotBefore: time.Now(), NotAfter: time.Now().Add(time.Hour)}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, rsaKey.Public(), rsaKey)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	rsaCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}))
+
+	tests := []struct {
+		name    string
+		keys    jwtKeys
+		wantErr string
+	}{
+		{"rsa", jwtKeys{rsaPriv, rsaPub, "RS256"}, ""},
+		{"rsa pss", jwtKeys{rsaPriv, rsaPub, "PS384"}, ""},
+		{"rsa pkcs1 private key", jwtKeys{rsaPKCS1Priv, rsaPub, "RS256"}, ""},
+		{"rsa certificate", jwtKeys{rsaPriv, rsaCert, "RS512"}, ""},
+		{"ecdsa", jwtKeys{ecPriv, ecPub, "ES256"}, ""},
+		{"ecdsa sec1 private key", jwtKeys{ecSEC1Priv, ecPub, "ES256"}, ""},
+		{"hmac", jwtKeys{"shared-secret", "", "HS256"}, ""},
+		{"hmac without secret", jwtKeys{"", "", "HS512"}, "requires a shared secret"},
+		{"rsa key with ecdsa method", jwtKeys{rsaPriv, rsaPub, "ES256"}, "invalid jwt private key for sign method ES256"},
+		{"wrong curve", jwtKeys{ecPriv, ecPub, "ES384"}, "requires a 384-bit curve"},
+		{"unsupported method", jwtKeys{ecPriv, ecPub, "EdDSA"}, "unsupported jwt sign method"},
+		{"mismatched pair", jwtKeys{ecPriv, otherPub, "ES256"}, "does not match"},
+		{"garbage", jwtKeys{"nope", ecPub, "ES256"}, "invalid jwt private key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.keys.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	setupTestDirs(t)
+
+	current, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	next, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	currentPriv, currentPub := encodeTestKeyPair(t, current)
+	nextPriv, nextPub := encodeTestKeyPair(t, next)
+
+	t.Setenv("ETCD_JWT_PRIVATE", currentPriv)
+	t.Setenv("ETCD_JWT_PUBLIC", currentPub)
+	t.Setenv("ETCD_JWT_SIGN_METHOD", "ES256")
+
+	config, err := NewConfig()
+	if err != nil {
+		t.Fatalf("NewConfig failed: %v", err)
+	}
+
+	// Keys that fail validation on boot are still handed to etcd.
+	t.Setenv("ETCD_JWT_SIGN_METHOD", "ES384")
+	if err := config.SetAuthToken(); err != nil {
+		t.Fatalf("expected SetAuthToken to tolerate invalid keys, got %v", err)
+	}
+	t.Setenv("ETCD_JWT_SIGN_METHOD", "ES256")
+
+	info, err := os.Stat(filepath.Join(DataDir, "certs", "jwt_token"))
+	if err != nil {
+		t.Fatalf("failed to stat private key: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected private key permissions 0600, got %o", info.Mode().Perm())
+	}
+
+	// Staging a key pair doesn't affect members until they're moved over.
+	t.Setenv("ETCD_JWT_PRIVATE_NEXT", nextPriv)
+	t.Setenv("ETCD_JWT_PUBLIC_NEXT", nextPub)
+	if err := config.SetAuthToken(); err != nil {
+		t.Fatalf("SetAuthToken failed: %v", err)
+	}
+	if !config.usingJWTKeys(currentJWTKeys()) {
+		t.Error("expected the current key to remain active")
+	}
+
+	// A bad staged pair is rejected before the member is moved over.
+	t.Setenv("ETCD_JWT_PUBLIC_NEXT", currentPub)
+	if err := config.ApplyNextJWTKeys(); err == nil {
+		t.Fatal("expected ApplyNextJWTKeys to reject a mismatched pair")
+	}
+	if !config.usingJWTKeys(currentJWTKeys()) {
+		t.Error("expected the current key to remain active")
+	}
+	t.Setenv("ETCD_JWT_PUBLIC_NEXT", nextPub)
+
+	if err := config.ApplyNextJWTKeys(); err != nil {
+		t.Fatalf("ApplyNextJWTKeys failed: %v", err)
+	}
+
+	// A restart keeps the staged key once the member has been moved over.
+	if err := config.SetAuthToken(); err != nil {
+		t.Fatalf("SetAuthToken failed: %v", err)
+	}
+	if !config.usingJWTKeys(nextJWTKeys()) {
+		t.Error("expected the staged key to remain active")
+	}
+}
+
+func TestJWTHMACRotation(t *testing.T) {
+	setupTestDirs(t)
+
+	t.Setenv("ETCD_JWT_PRIVATE", "current-secret")
+	t.Setenv("ETCD_JWT_SIGN_METHOD", "HS256")
+
+	config, err := NewConfig()
+	if err != nil {
+		t.Fatalf("NewConfig failed: %v", err)
+	}
+	if !strings.Contains(config.AuthToken, "sign-method=HS256") {
+		t.Fatalf("expected jwt auth without a public key, got %q", config.AuthToken)
+	}
+
+	t.Setenv("ETCD_JWT_PRIVATE_NEXT", "next-secret")
+	if err := config.SetAuthToken(); err != nil {
+		t.Fatalf("SetAuthToken failed: %v", err)
+	}
+	if !config.usingJWTKeys(currentJWTKeys()) {
+		t.Error("expected the current secret to remain active")
+	}
+
+	if err := config.ApplyNextJWTKeys(); err != nil {
+		t.Fatalf("ApplyNextJWTKeys failed: %v", err)
+	}
+	if err := config.SetAuthToken(); err != nil {
+		t.Fatalf("SetAuthToken failed: %v", err)
+	}
+	if !config.usingJWTKeys(nextJWTKeys()) {
+		t.Error("expected the staged secret to remain active")
+	}
+}
@@ -0,0 +1,115 @@
+package flyetcd
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	client "go.etcd.io/etcd/client/v3"
+)
+
+// defaultLearnerPromotionThreshold is the number of raft entries a learner must trail the
+// leader by less than before it is considered caught up.
+const defaultLearnerPromotionThreshold = 1000
+
+// LearnerPromotionThreshold returns the configured promotion threshold.
+func LearnerPromotionThreshold() uint64 {
+	threshold := getEnvOrDefault("ETCD_LEARNER_PROMOTION_THRESHOLD", defaultLearnerPromotionThreshold)
+	if threshold <= 0 {
+		log.Printf("invalid learner promotion threshold %d, using default %d", threshold, defaultLearnerPromotionThreshold)
+		threshold = defaultLearnerPromotionThreshold
+	}
+	return uint64(threshold)
+}
+
+// LearnerProgress describes how far a learner has caught up with the leader.
+type LearnerProgress struct {
+	MemberID           uint64 `json:"member_id"`
+	Name               string `json:"name"`
+	IsLearner          bool   `json:"is_learner"`
+	AppliedIndex       uint64 `json:"applied_index"`
+	LeaderAppliedIndex uint64 `json:"leader_applied_index"`
+	Gap                uint64 `json:"gap"`
+	Threshold          uint64 `json:"threshold"`
+	CaughtUp           bool   `json:"caught_up"`
+}
+
+// LearnerProgress compares the raft applied index of the member associated with the specified
+// machineID against the leader's.
+func (c *Client) LearnerProgress(ctx context.Context, machineID string, threshold uint64) (*LearnerProgress, error) {
+	resp, err := c.MemberList(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return learnerProgress(resp.Members, machineID, threshold, func(url string) (*client.StatusResponse, error) {
+		return c.Status(ctx, url)
+	})
+}
+
+// learnerProgress evaluates the member's progress, using status to look up the raft applied
+// index of the learner and the leader.
+func learnerProgress(members []*etcdserverpb.Member, machineID string, threshold uint64, status func(url string) (*client.StatusResponse, error)) (*LearnerProgress, error) {
+	endpoint := NewEndpoint(machineID)
+	self := findMember(members, endpoint)
+	if self == nil {
+		return nil, &MemberNotFoundError{Err: fmt.Errorf("no member found with matching machine id: %q", machineID)}
+	}
+
+	progress := &LearnerProgress{
+		MemberID:  self.ID,
+		Name:      endpoint.Name,
+		IsLearner: self.IsLearner,
+		Threshold: threshold,
+	}
+
+	if !self.IsLearner {
+		return progress, nil
+	}
+
+	learnerStatus, err := status(endpoint.ClientURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get learner status: %w", err)
+	}
+	progress.AppliedIndex = learnerStatus.RaftAppliedIndex
+
+	var leaderURL string
+	for _, member := range members {
+		if member.ID == learnerStatus.Leader && len(member.ClientURLs) > 0 {
+			leaderURL = member.ClientURLs[0]
+		}
+	}
+	if leaderURL == "" {
+		return nil, fmt.Errorf("no leader found")
+	}
+
+	leaderStatus, err := status(leaderURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get leader status: %w", err)
+	}
+	progress.LeaderAppliedIndex = leaderStatus.RaftAppliedIndex
+
+	if progress.LeaderAppliedIndex > progress.AppliedIndex {
+		progress.Gap = progress.LeaderAppliedIndex - progress.AppliedIndex
+	}
+	progress.CaughtUp = progress.Gap < threshold
+
+	return progress, nil
+}
+
+// findMember returns the member matching the endpoint's name or peer URL. Members that were
+// added but have not yet started have no name, so the peer URL is used as a fallback.
+func findMember(members []*etcdserverpb.Member, endpoint *Endpoint) *etcdserverpb.Member {
+	for _, member := range members {
+		if member.Name == endpoint.Name {
+			return member
+		}
+		for _, peerURL := range member.PeerURLs {
+			if peerURL == endpoint.PeerURL {
+				return member
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package flyetcd
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	client "go.etcd.io/etcd/client/v3"
+)
+
+func TestLearnerProgress(t *testing.T) {
+	setupTestDirs(t)
+	t.Setenv("FLY_APP_NAME", "test-app")
+
+	learner := NewEndpoint("learner")
+	members := []*etcdserverpb.Member{
+		{ID: 1, Name: "leader", ClientURLs: []string{"http://leader:2379"}},
+		{ID: 2, Name: "learner", IsLearner: true, ClientURLs: []string{learner.ClientURL}},
+		{ID: 3, Name: "voter", ClientURLs: []string{"http://voter:2379"}},
+	}
+
+	statusOf := func(learnerApplied, leaderApplied uint64) func(string) (*client.StatusResponse, error) {
+		return func(url string) (*client.StatusResponse, error) {
+			switch url {
+			case learner.ClientURL:
+				return &client.StatusResponse{Leader: 1, RaftAppliedIndex: learnerApplied}, nil
+			case "http://leader:2379":
+				return &client.StatusResponse{Leader: 1, RaftAppliedIndex: leaderApplied}, nil
+			}
+			return nil, fmt.Errorf("unexpected status request for %s", url)
+		}
+	}
+
+	tests := []struct {
+		name           string
+		learnerIndex   uint64
+		leaderIndex    uint64
+		threshold      uint64
+		expectGap      uint64
+		expectCaughtUp bool
+	}{
+		{name: "far behind", learnerIndex: 100, leaderIndex: 5000, threshold: 1000, expectGap: 4900},
+		{name: "gap at threshold", learnerIndex: 4000, leaderIndex: 5000, threshold: 1000, expectGap: 1000},
+		{name: "gap below threshold", learnerIndex: 4001, leaderIndex: 5000, threshold: 1000, expectGap: 999, expectCaughtUp: true},
+		{name: "in sync", learnerIndex: 5000, leaderIndex: 5000, threshold: 1000, expectCaughtUp: true},
+		// The learner's status can be sampled after the leader's has moved on.
+		{name: "learner ahead", learnerIndex: 5001, leaderIndex: 5000, threshold: 1, expectCaughtUp: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress, err := learnerProgress(members, "learner", tt.threshold, statusOf(tt.learnerIndex, tt.leaderIndex))
+			if err != nil {
+				t.Fatalf("learnerProgress failed: %v", err)
+			}
+			if !progress.IsLearner || progress.MemberID != 2 {
+				t.Errorf("unexpected member in %+v", progress)
+			}
+			if progress.Gap != tt.expectGap {
+				t.Errorf("expected gap %d, got %d", tt.expectGap, progress.Gap)
+			}
+			if progress.CaughtUp != tt.expectCaughtUp {
+				t.Errorf("expected caught up %v, got %v", tt.expectCaughtUp, progress.CaughtUp)
+			}
+		})
+	}
+
+	t.Run("already voting", func(t *testing.T) {
+		progress, err := learnerProgress(members, "voter", 1000, func(url string) (*client.StatusResponse, error) {
+			t.Errorf("unexpected status request for %s", url)
+			return nil, fmt.Errorf("unexpected status request")
+		})
+		if err != nil {
+			t.Fatalf("learnerProgress failed: %v", err)
+		}
+		if progress.IsLearner || progress.MemberID != 3 {
+			t.Errorf("expected voting member 3, got %+v", progress)
+		}
+	})
+
+	t.Run("member not found", func(t *testing.T) {
+		_, err := learnerProgress(members, "missing", 1000, statusOf(0, 0))
+		var notFound *MemberNotFoundError
+		if !errors.As(err, &notFound) {
+			t.Errorf("expected MemberNotFoundError, got %v", err)
+		}
+	})
+
+	t.Run("no leader", func(t *testing.T) {
+		status := func(string) (*client.StatusResponse, error) {
+			return &client.StatusResponse{Leader: 99}, nil
+		}
+		if _, err := learnerProgress(members, "learner", 1000, status); err == nil {
+			t.Error("expected an error when the leader isn't a member")
+		}
+	})
+}
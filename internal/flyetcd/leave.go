@@ -0,0 +1,86 @@
+package flyetcd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"syscall"
+	"time"
+)
+
+var DecommissionedFilePath = "/data/decommissioned"
+
+// defaultLeaderHandoffTimeout leaves room within the default kill_timeout of 30s for etcd to
+// shut down once leadership has been handed off.
+const defaultLeaderHandoffTimeout = 15 * time.Second
+
+const (
+	// EtcdStopSignal instructs the supervisor to stop etcd while the machine keeps running.
+	EtcdStopSignal = syscall.SIGUSR1
+	// EtcdRestartSignal instructs the supervisor to restart etcd.
+	EtcdRestartSignal = syscall.SIGHUP
+
+	// RestartLockKey is the lock held while a member restarts etcd to reload its configuration,
+	// so only one member restarts at a time.
+	RestartLockKey = "/fly-etcd/locks/restart"
+)
+
+// LeaveResult describes the outcome of a graceful leave.
+type LeaveResult struct {
+	MemberID  uint64 `json:"member_id"`
+	NewLeader uint64 `json:"new_leader,omitempty"`
+}
+
+// Leave gracefully removes this machine from the cluster. Leadership is handed off first if
+// this member holds it, and the volume is marked as decommissioned so a restart can't rejoin
+// the cluster with stale data.
+func (n *Node) Leave(ctx context.Context, client *Client) (*LeaveResult, error) {
+	memberID, err := client.MemberID(ctx, n.MachineID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &LeaveResult{MemberID: memberID}
+
+	newLeader, err := client.TransferLeadership(ctx, n.MachineID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to transfer leadership: %w", err)
+	}
+	if newLeader != 0 {
+		log.Printf("Leadership transferred from %x to %x", memberID, newLeader)
+		result.NewLeader = newLeader
+	}
+
+	if _, err := client.MemberRemove(ctx, memberID); err != nil {
+		return nil, fmt.Errorf("failed to remove member %x: %w", memberID, err)
+	}
+	log.Printf("Member %x removed from the cluster", memberID)
+
+	if err := markDecommissioned(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// LeaderHandoffTimeout returns how long shutdown may wait on leadership to be handed off.
+func LeaderHandoffTimeout() time.Duration {
+	return getEnvOrDefault("ETCD_LEADER_HANDOFF_TIMEOUT", defaultLeaderHandoffTimeout)
+}
+
+// Decommissioned returns true if this machine has left the cluster.
+func Decommissioned() bool {
+	if _, err := os.Stat(DecommissionedFilePath); err != nil {
+		return false
+	}
+	return true
+}
+
+func markDecommissioned() error {
+	data := []byte(time.Now().UTC().Format(time.RFC3339))
+	if err := writeFileAtomic(DecommissionedFilePath, data, 0600); err != nil {
+		return fmt.Errorf("failed to mark volume as decommissioned: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package flyetcd
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+)
+
+const (
+	// ClientBindAll serves clients on every interface.
+	ClientBindAll = "all"
+	// ClientBindPrivate serves clients on the 6PN address only. Loopback is always included.
+	ClientBindPrivate = "6pn"
+	// ClientBindProxy additionally serves clients on the interface the Fly proxy forwards flycast
+	// and service traffic to.
+	ClientBindProxy = "proxy"
+
+	// proxyInterface is the interface the Fly proxy delivers traffic on.
+	proxyInterface = "eth0"
+)
+
+// MetricsListenURL returns the URL etcd serves metrics on. With ETCD_METRICS_BIND=localhost,
+// metrics are only reachable through the etcd-backup metrics proxy.
+func MetricsListenURL() string {
+	switch bind := getEnvOrDefault("ETCD_METRICS_BIND", "all"); bind {
+	case "all":
+		return MetricsBaseURL
+	case "localhost":
+		return "http://127.0.0.1:2381"
+	default:
+		log.Printf("invalid metrics bind %q, listening on all interfaces", bind)
+		return MetricsBaseURL
+	}
+}
+
+// listenClientURLs returns the URLs etcd serves clients on. Plaintext can be kept alongside
+// TLS with ETCD_CLIENT_PLAINTEXT while clients are being migrated.
+func listenClientURLs() string {
+	schemes := []string{"http"}
+	if ClientTLSEnabled() {
+		schemes = []string{"https"}
+		if getEnvOrDefault("ETCD_CLIENT_PLAINTEXT", false) {
+			schemes = append(schemes, "http")
+		}
+	}
+
+	var urls []string
+	for _, scheme := range schemes {
+		for _, host := range clientListenHosts() {
+			urls = append(urls, fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, "2379")))
+		}
+	}
+	return strings.Join(urls, ",")
+}
+
+// clientListenHosts resolves ETCD_CLIENT_BIND to the addresses the client listener binds to.
+// Falls back to every interface when the addresses can't be resolved, as members rely on
+// reaching each other's client URLs.
+func clientListenHosts() []string {
+	bind := getEnvOrDefault("ETCD_CLIENT_BIND", ClientBindAll)
+	if bind == ClientBindAll {
+		return []string{"::"}
+	}
+	if bind != ClientBindPrivate && bind != ClientBindProxy {
+		log.Printf("invalid client bind %q, listening on all interfaces", bind)
+		return []string{"::"}
+	}
+
+	private := privateIPs()
+	if len(private) == 0 {
+		log.Printf("[warn] FLY_PRIVATE_IP is not set, listening on all interfaces")
+		return []string{"::"}
+	}
+
+	hosts := []string{"127.0.0.1", "::1"}
+	for _, ip := range private {
+		hosts = append(hosts, ip.String())
+	}
+
+	if bind == ClientBindProxy {
+		ips, err := interfaceIPv4s(proxyInterface)
+		if err != nil || len(ips) == 0 {
+			log.Printf("[warn] failed to resolve the address of %s, listening on all interfaces: %v", proxyInterface, err)
+			return []string{"::"}
+		}
+		for _, ip := range ips {
+			hosts = append(hosts, ip.String())
+		}
+	}
+
+	return hosts
+}
+
+// interfaceIPv4s returns the IPv4 addresses assigned to the named interface.
+func interfaceIPv4s(name string) ([]net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var ips []net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ip := ipNet.IP.To4(); ip != nil {
+			ips = append(ips, ip)
+		}
+	}
+	return ips, nil
+}
@@ -0,0 +1,68 @@
+package flyetcd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenClientURLs(t *testing.T) {
+	t.Run("all interfaces by default", func(t *testing.T) {
+		if got := listenClientURLs(); got != "http://[::]:2379" {
+			t.Errorf("expected all interfaces, got %q", got)
+		}
+	})
+
+	t.Run("6pn", func(t *testing.T) {
+		t.Setenv("ETCD_CLIENT_BIND", "6pn")
+		t.Setenv("FLY_PRIVATE_IP", "fdaa:0:1:a7b:1::2")
+
+		expected := "http://127.0.0.1:2379,http://[::1]:2379,http://[fdaa:0:1:a7b:1::2]:2379"
+		if got := listenClientURLs(); got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	})
+
+	t.Run("6pn without a private ip", func(t *testing.T) {
+		t.Setenv("ETCD_CLIENT_BIND", "6pn")
+		t.Setenv("FLY_PRIVATE_IP", "")
+
+		if got := listenClientURLs(); got != "http://[::]:2379" {
+			t.Errorf("expected fallback to all interfaces, got %q", got)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Setenv("ETCD_CLIENT_BIND", "public")
+
+		if got := listenClientURLs(); got != "http://[::]:2379" {
+			t.Errorf("expected fallback to all interfaces, got %q", got)
+		}
+	})
+}
+
+func TestMetricsListenURL(t *testing.T) {
+	t.Run("localhost", func(t *testing.T) {
+		tmpDir := setupTestDirs(t)
+		t.Setenv("ETCD_METRICS_BIND", "localhost")
+
+		if err := os.WriteFile(filepath.Join(tmpDir, "etcd.yaml"), []byte("listen-metrics-urls: http://[::]:2381\n"), 0644); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+
+		cfg, err := resolveConfig()
+		if err != nil {
+			t.Fatalf("resolveConfig failed: %v", err)
+		}
+		if cfg.ListenMetricsUrls != "http://127.0.0.1:2381" {
+			t.Errorf("expected metrics bound to localhost, got %q", cfg.ListenMetricsUrls)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Setenv("ETCD_METRICS_BIND", "eth0")
+		if got := MetricsListenURL(); got != MetricsBaseURL {
+			t.Errorf("expected %q, got %q", MetricsBaseURL, got)
+		}
+	})
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
 	yaml "gopkg.in/yaml.v3"
 )
 
@@ -35,44 +37,197 @@ func NewNode() (*Node, error) {
 }
 
 func (n *Node) Bootstrap(ctx context.Context) error {
+	journal, err := readBootstrapJournal()
+	if err != nil {
+		return err
+	}
+
 	client, err := NewClient([]string{})
 	if err != nil {
 		return fmt.Errorf("failed to initialize etcd client: %w", err)
 	}
 
-	// TODO - Known race condition here. Consider using a discovery cluster or multi-tenant consul to
-	// flag that the cluster has been initialized.
+	// A previous boot registered this machine, but crashed before writing the config.
+	if journal.State == BootstrapStateMemberAdded {
+		resumed, err := n.resumeJoin(ctx, client, journal)
+		if err != nil {
+			return fmt.Errorf("failed to resume bootstrap: %w", err)
+		}
+		if resumed {
+			return nil
+		}
+	}
+
 	clusterReady, err := clusterInitialized(ctx, client, n)
 	if err != nil {
 		return fmt.Errorf("failed to verify cluster state: %w", err)
 	}
 
-	// If the cluster is ready, add the node to the cluster.
-	if clusterReady {
-		mCtx, cancel := context.WithTimeout(ctx, (5 * time.Second))
-		resp, err := client.MemberAdd(mCtx, []string{n.Endpoint.PeerURL})
-		cancel()
+	// When configured with an initial cluster size, wait for every machine and form the
+	// cluster from all of them at once.
+	if !clusterReady {
+		if size := initialClusterSize(); size > 1 {
+			formed, err := n.bootstrapStatic(ctx, journal, size)
+			if err != nil {
+				return err
+			}
+			if formed {
+				return nil
+			}
+
+			log.Printf("Not part of the initial cluster, waiting for it to be initialized")
+			if err := waitForCluster(ctx, client, n); err != nil {
+				return err
+			}
+			clusterReady = true
+		}
+	}
+
+	// When no cluster is reachable, elect a single seed to form it. Every other machine
+	// waits for the seed and joins as a learner.
+	if !clusterReady {
+		machines, err := discoverMachines(ctx, 1, discoveryTimeout)
 		if err != nil {
-			return fmt.Errorf("failed to add member to cluster: %w", err)
+			return fmt.Errorf("failed to discover machines: %w", err)
 		}
 
-		// Evaluate the response and build our initial cluster string.
-		var peerUrls []string
-		for _, member := range resp.Members {
-			for _, peerURL := range member.PeerURLs {
-				name := member.Name
-				if member.ID == resp.Member.ID {
-					name = n.Endpoint.Name
+		seed := resumeSeed(journal, machines)
+		if seed != "" {
+			log.Printf("Resuming bootstrap, %s was already elected as seed", seed)
+		} else {
+			seed, err = electSeed(machines)
+			if err != nil {
+				return fmt.Errorf("failed to elect bootstrap seed: %w", err)
+			}
+
+			journal.Seed = seed
+			if err := journal.advance(BootstrapStateDiscovered); err != nil {
+				return err
+			}
+		}
+
+		if seed == n.MachineID {
+			// Re-check in case a cluster was formed while discovery was settling.
+			clusterReady, err = clusterInitialized(ctx, client, n)
+			if err != nil {
+				return fmt.Errorf("failed to verify cluster state: %w", err)
+			}
+			if !clusterReady {
+				log.Printf("Elected as bootstrap seed, initializing a new cluster")
+				token, err := newClusterToken()
+				if err != nil {
+					return err
 				}
-				peer := fmt.Sprintf("%s=%s", name, peerURL)
-				peerUrls = append(peerUrls, peer)
+				if err := n.initializeClusterIdentity(token); err != nil {
+					return err
+				}
+				journal.Founder = true
+				return n.writeBootstrapConfig(journal)
+			}
+		} else {
+			log.Printf("Waiting for bootstrap seed %s to initialize the cluster", seed)
+			if err := waitForCluster(ctx, client, n); err != nil {
+				return err
 			}
 		}
-		n.Config.InitialCluster = strings.Join(peerUrls, ",")
+	}
+
+	if err := verifyClusterIdentity(ctx, client, n.AppName); err != nil {
+		return fmt.Errorf("refusing to join cluster: %w", err)
+	}
+
+	if err := preflight(ctx, client, n); err != nil {
+		return err
+	}
+
+	if err := removeStaleMember(ctx, client, n); err != nil {
+		return fmt.Errorf("failed to remove stale member: %w", err)
+	}
+
+	resp, err := addMember(ctx, client, n.Endpoint.PeerURL)
+	if err != nil {
+		return fmt.Errorf("failed to add member to cluster: %w", err)
+	}
+
+	journal.MemberID = resp.Member.ID
+	if err := journal.advance(BootstrapStateMemberAdded); err != nil {
+		return err
+	}
+
+	n.Config.InitialCluster = initialCluster(resp.Members, resp.Member.ID, n.Endpoint.Name)
+	n.Config.InitialClusterState = "existing"
+
+	return n.writeBootstrapConfig(journal)
+}
+
+// bootstrapStatic waits until the configured number of machines have been discovered and
+// writes an initial cluster containing all of them. Returns false if this machine is not
+// one of the initial members.
+func (n *Node) bootstrapStatic(ctx context.Context, journal *BootstrapJournal, size int) (bool, error) {
+	log.Printf("Waiting for %d machines to form the initial cluster", size)
+
+	machines, err := discoverMachines(ctx, size, staticDiscoveryTimeout)
+	if err != nil {
+		return false, fmt.Errorf("failed to discover machines: %w", err)
+	}
+
+	members := staticMembers(machines, size)
+	if !slices.Contains(members, n.MachineID) {
+		return false, nil
+	}
+
+	if err := journal.advance(BootstrapStateDiscovered); err != nil {
+		return false, err
+	}
+
+	if err := n.initializeClusterIdentity(staticClusterToken(members)); err != nil {
+		return false, err
+	}
+
+	n.Config.InitialCluster = staticInitialCluster(members)
+	n.Config.InitialClusterState = "new"
+	journal.Founder = true
+
+	log.Printf("Initializing a new cluster with members: %s", strings.Join(members, ", "))
+
+	return true, n.writeBootstrapConfig(journal)
+}
+
+// resumeJoin writes the config for a member that was added by a previous boot. Returns false
+// if the member is no longer registered, in which case bootstrap should start over.
+func (n *Node) resumeJoin(ctx context.Context, client *Client, journal *BootstrapJournal) (bool, error) {
+	mCtx, cancel := context.WithTimeout(ctx, (10 * time.Second))
+	resp, err := client.MemberList(mCtx)
+	cancel()
+	if err != nil {
+		return false, err
+	}
+
+	for _, member := range resp.Members {
+		if member.ID != journal.MemberID {
+			continue
+		}
+
+		log.Printf("Resuming bootstrap, member %x was already added", journal.MemberID)
+
+		// Membership may have changed since the member was added, so the initial cluster
+		// is rebuilt from the current member list.
+		n.Config.InitialCluster = initialCluster(resp.Members, journal.MemberID, n.Endpoint.Name)
 		n.Config.InitialClusterState = "existing"
+
+		return true, n.writeBootstrapConfig(journal)
 	}
 
-	return WriteConfig(n.Config)
+	log.Printf("Member %x from a previous bootstrap attempt is no longer registered, starting over", journal.MemberID)
+
+	return false, nil
+}
+
+func (n *Node) writeBootstrapConfig(journal *BootstrapJournal) error {
+	if err := WriteConfig(n.Config); err != nil {
+		return err
+	}
+	return journal.advance(BootstrapStateConfigWritten)
 }
 
 func resolveConfig() (*Config, error) {
@@ -92,7 +247,32 @@ func resolveConfig() (*Config, error) {
 
 		// Dynamic configuration settings that may need to be adjusted on boot.
 		cfg.DataDir = DataDir
-		cfg.ListenMetricsUrls = MetricsBaseURL
+		cfg.ListenMetricsUrls = MetricsListenURL()
+
+		// The client URLs follow the client TLS settings, so clients can be moved over to TLS
+		// with a restart. They're only rewritten when their schemes no longer match, so customized
+		// addresses are kept, unless ETCD_CLIENT_BIND asks for the listener to be rebound.
+		listen := listenClientURLs()
+		_, rebind := os.LookupEnv("ETCD_CLIENT_BIND")
+		if cfg.ListenClientUrls != listen && (rebind || !slices.Equal(urlSchemes(cfg.ListenClientUrls), urlSchemes(listen))) {
+			log.Printf("[info] replacing listen-client-urls %q from %s with %q", cfg.ListenClientUrls, ConfigFilePath, listen)
+			cfg.ListenClientUrls = listen
+		}
+		if !urlsHaveScheme(cfg.AdvertiseClientUrls, clientScheme()) {
+			advertise := NewEndpoint(os.Getenv("FLY_MACHINE_ID")).ClientURL
+			log.Printf("[info] replacing advertise-client-urls %q from %s with %q", cfg.AdvertiseClientUrls, ConfigFilePath, advertise)
+			cfg.AdvertiseClientUrls = advertise
+		}
+	}
+
+	// The advertised URL override must match the client scheme, or members would advertise a
+	// URL clients can't connect to.
+	if advertise, ok := os.LookupEnv("ETCD_ADVERTISE_CLIENT_URLS"); ok {
+		if urlsHaveScheme(advertise, clientScheme()) {
+			cfg.AdvertiseClientUrls = advertise
+		} else {
+			log.Printf("[warn] ignoring ETCD_ADVERTISE_CLIENT_URLS %q, client urls must use %s", advertise, clientScheme())
+		}
 	}
 
 	// Env vars override everything.
@@ -102,7 +282,6 @@ func resolveConfig() (*Config, error) {
 	cfg.QuotaBackendBytes = getEnvOrDefault("ETCD_QUOTA_BACKEND_BYTES", cfg.QuotaBackendBytes)
 	cfg.AutoCompactionMode = getEnvOrDefault("ETCD_AUTO_COMPACTION_MODE", cfg.AutoCompactionMode)
 	cfg.AutoCompactionRetention = getEnvOrDefault("ETCD_AUTO_COMPACTION_RETENTION", cfg.AutoCompactionRetention)
-	cfg.AdvertiseClientUrls = getEnvOrDefault("ETCD_ADVERTISE_CLIENT_URLS", cfg.AdvertiseClientUrls)
 
 	cfg.BcryptCost = getEnvOrDefault("ETCD_BCRYPT_COST", cfg.BcryptCost)
 	if cfg.BcryptCost < minBcryptCost || cfg.BcryptCost > maxBcryptCost {
@@ -118,6 +297,48 @@ func resolveConfig() (*Config, error) {
 	return cfg, nil
 }
 
+// urlsHaveScheme returns true if every URL in the comma separated list uses the scheme.
+// urlSchemes returns the sorted, distinct schemes of a comma separated list of URLs.
+func urlSchemes(urls string) []string {
+	var schemes []string
+	for _, u := range strings.Split(urls, ",") {
+		scheme, _, _ := strings.Cut(strings.TrimSpace(u), "://")
+		if !slices.Contains(schemes, scheme) {
+			schemes = append(schemes, scheme)
+		}
+	}
+	slices.Sort(schemes)
+	return schemes
+}
+
+func urlsHaveScheme(urls, scheme string) bool {
+	if urls == "" {
+		return false
+	}
+	for _, u := range strings.Split(urls, ",") {
+		if !strings.HasPrefix(strings.TrimSpace(u), scheme+"://") {
+			return false
+		}
+	}
+	return true
+}
+
+// initialCluster builds the initial cluster string from the membership returned when adding
+// ourselves. Our own member has yet to start, so its name is taken from the endpoint.
+func initialCluster(members []*etcdserverpb.Member, selfID uint64, selfName string) string {
+	var peerUrls []string
+	for _, member := range members {
+		name := memberMachineID(member)
+		if member.ID == selfID {
+			name = selfName
+		}
+		for _, peerURL := range member.PeerURLs {
+			peerUrls = append(peerUrls, fmt.Sprintf("%s=%s", name, peerURL))
+		}
+	}
+	return strings.Join(peerUrls, ",")
+}
+
 // clusterInitialized will check-in with the the other nodes within the network
 // to see if any of them respond to status.
 func clusterInitialized(ctx context.Context, client *Client, node *Node) (bool, error) {
@@ -0,0 +1,216 @@
+package flyetcd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const preflightDialTimeout = 3 * time.Second
+
+// PreflightError lists every check that failed before joining the cluster.
+type PreflightError struct {
+	Failures []string
+}
+
+func (e *PreflightError) Error() string {
+	return fmt.Sprintf("preflight checks failed:\n  - %s", strings.Join(e.Failures, "\n  - "))
+}
+
+// HandshakeResponse is returned by the admin API after dialing a machine preparing to join.
+type HandshakeResponse struct {
+	Reachable bool   `json:"reachable"`
+	Error     string `json:"error,omitempty"`
+}
+
+// preflight verifies connectivity with every existing member before this machine is added to
+// the cluster. A member that can't talk to its peers costs the cluster quorum, so it's better
+// to fail before membership changes.
+func preflight(ctx context.Context, client *Client, node *Node) error {
+	var failures []string
+
+	peerHost, peerPort, err := hostPort(node.Endpoint.PeerURL)
+	if err != nil {
+		return err
+	}
+
+	if _, err := net.DefaultResolver.LookupHost(ctx, peerHost); err != nil {
+		failures = append(failures, fmt.Sprintf("peer url %s does not resolve: %v", node.Endpoint.PeerURL, err))
+	}
+
+	members, err := existingMembers(ctx, client, node)
+	if err != nil {
+		return fmt.Errorf("failed to resolve existing members: %w", err)
+	}
+
+	for _, member := range members {
+		for _, target := range []string{member.PeerURL, member.ClientURL} {
+			if err := dial(ctx, target); err != nil {
+				failures = append(failures, fmt.Sprintf("%s is unreachable: %v", target, err))
+			}
+		}
+	}
+
+	// Listen on our peer port until etcd starts, so the other members can confirm they're
+	// able to reach us.
+	listener, err := net.Listen("tcp", net.JoinHostPort("", peerPort))
+	if err != nil {
+		failures = append(failures, fmt.Sprintf("failed to listen on peer port %s: %v", peerPort, err))
+	} else {
+		defer func() {
+			_ = listener.Close()
+		}()
+
+		go acceptAndClose(listener)
+
+		for _, member := range members {
+			if err := handshake(ctx, member, net.JoinHostPort(peerHost, peerPort)); err != nil {
+				failures = append(failures, fmt.Sprintf("%s is unable to reach this machine: %v", member.Name, err))
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return &PreflightError{Failures: failures}
+	}
+
+	log.Printf("Preflight checks passed against %d member(s)", len(members))
+
+	return nil
+}
+
+// existingMembers returns the endpoints of the started members registered with the cluster.
+func existingMembers(ctx context.Context, client *Client, node *Node) ([]*Endpoint, error) {
+	endpoints, err := AllEndpoints(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mCtx, cancel := context.WithTimeout(ctx, (5 * time.Second))
+	resp, err := client.MemberList(mCtx)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	started := map[string]bool{}
+	for _, member := range resp.Members {
+		if member.Name != "" {
+			started[member.Name] = true
+		}
+	}
+
+	var members []*Endpoint
+	for _, endpoint := range endpoints {
+		if endpoint.Name == node.Endpoint.Name || !started[endpoint.Name] {
+			continue
+		}
+		members = append(members, endpoint)
+	}
+
+	return members, nil
+}
+
+// handshake asks the member's admin API to dial the specified address.
+func handshake(ctx context.Context, member *Endpoint, addr string) error {
+	ctx, cancel := context.WithTimeout(ctx, (2 * preflightDialTimeout))
+	defer cancel()
+
+	target := fmt.Sprintf("%s/preflight/dial?addr=%s", member.AdminURL, url.QueryEscape(addr))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	AuthorizeAdminRequest(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	// Members running an older release don't support the handshake.
+	if resp.StatusCode == http.StatusNotFound {
+		log.Printf("[warn] %s does not support the preflight handshake, skipping", member.Name)
+		return nil
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%s rejected the preflight handshake, check that ETCD_ADMIN_TOKEN matches across machines", member.Name)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("preflight handshake with %s failed with status %d: %s", member.Name, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result HandshakeResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode handshake response: %w", err)
+	}
+
+	if !result.Reachable {
+		return fmt.Errorf("%s", result.Error)
+	}
+
+	return nil
+}
+
+// ValidateHandshakeAddr ensures the admin API only dials etcd ports on machines within this app.
+func ValidateHandshakeAddr(addr, appName string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(host, fmt.Sprintf(".vm.%s.internal", appName)) {
+		return fmt.Errorf("host %q does not belong to app %q", host, appName)
+	}
+	if port != "2379" && port != "2380" {
+		return fmt.Errorf("port %q is not an etcd port", port)
+	}
+	return nil
+}
+
+// Dial opens and immediately closes a TCP connection with the address.
+func Dial(ctx context.Context, addr string) error {
+	d := net.Dialer{Timeout: preflightDialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func dial(ctx context.Context, target string) error {
+	host, port, err := hostPort(target)
+	if err != nil {
+		return err
+	}
+	return Dial(ctx, net.JoinHostPort(host, port))
+}
+
+func acceptAndClose(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		_ = conn.Close()
+	}
+}
+
+func hostPort(target string) (string, string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to parse %q: %w", target, err)
+	}
+	return u.Hostname(), u.Port(), nil
+}
@@ -0,0 +1,34 @@
+package flyetcd
+
+import (
+	"testing"
+)
+
+// The admin API dials on behalf of anyone that can reach it, so it must stay restricted to
+// etcd ports on machines within the app.
+func TestValidateHandshakeAddr(t *testing.T) {
+	cases := []struct {
+		name  string
+		addr  string
+		valid bool
+	}{
+		{"peer port", "148e21da.vm.test-app.internal:2380", true},
+		{"client port", "148e21da.vm.test-app.internal:2379", true},
+		{"other port", "148e21da.vm.test-app.internal:22", false},
+		{"other app", "148e21da.vm.other-app.internal:2380", false},
+		{"external host", "example.com:2380", false},
+		{"missing port", "148e21da.vm.test-app.internal", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateHandshakeAddr(tc.addr, "test-app")
+			if tc.valid && err != nil {
+				t.Errorf("expected %q to be valid, got %v", tc.addr, err)
+			}
+			if !tc.valid && err == nil {
+				t.Errorf("expected %q to be rejected", tc.addr)
+			}
+		})
+	}
+}
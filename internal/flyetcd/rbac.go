@@ -0,0 +1,413 @@
+package flyetcd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.etcd.io/etcd/api/v3/authpb"
+	client "go.etcd.io/etcd/client/v3"
+	yaml "gopkg.in/yaml.v3"
+)
+
+const rootName = "root"
+
+// User is an etcd user along with the roles granted to it.
+type User struct {
+	Name  string   `yaml:"name"`
+	Roles []string `yaml:"roles,omitempty"`
+	// PasswordEnv names the env var holding the user's password when it's created declaratively.
+	PasswordEnv string `yaml:"password-env,omitempty"`
+}
+
+// Role is an etcd role along with the permissions granted to it.
+type Role struct {
+	Name        string       `yaml:"name"`
+	Permissions []Permission `yaml:"permissions,omitempty"`
+}
+
+// Permission grants access to a single key, a key prefix or a key range.
+type Permission struct {
+	Type     string `yaml:"type"`
+	Key      string `yaml:"key"`
+	Prefix   bool   `yaml:"prefix,omitempty"`
+	RangeEnd string `yaml:"range-end,omitempty"`
+}
+
+// ParsePermissionType parses read, write or readwrite.
+func ParsePermissionType(s string) (client.PermissionType, error) {
+	t, ok := authpb.Permission_Type_value[strings.ToUpper(s)]
+	if !ok {
+		return 0, fmt.Errorf("invalid permission type %q, must be one of read, write or readwrite", s)
+	}
+	return client.PermissionType(t), nil
+}
+
+// KeyRange returns the key and range end the permission applies to.
+func (p Permission) KeyRange() (string, string) {
+	if p.Prefix {
+		return p.Key, client.GetPrefixRangeEnd(p.Key)
+	}
+	return p.Key, p.RangeEnd
+}
+
+func newPermission(perm *authpb.Permission) Permission {
+	p := Permission{
+		Type: strings.ToLower(perm.PermType.String()),
+		Key:  string(perm.Key),
+	}
+
+	rangeEnd := string(perm.RangeEnd)
+	switch {
+	case rangeEnd == "":
+	case rangeEnd == client.GetPrefixRangeEnd(p.Key):
+		p.Prefix = true
+	default:
+		p.RangeEnd = rangeEnd
+	}
+	return p
+}
+
+// Users returns every user along with their roles, sorted by name.
+func (c *Client) Users(ctx context.Context) ([]User, error) {
+	resp, err := c.UserList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	users := make([]User, 0, len(resp.Users))
+	for _, name := range resp.Users {
+		user, err := c.UserGet(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user %s: %w", name, err)
+		}
+		roles := append([]string{}, user.Roles...)
+		sort.Strings(roles)
+		users = append(users, User{Name: name, Roles: roles})
+	}
+
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users, nil
+}
+
+// Roles returns every role along with their permissions, sorted by name.
+func (c *Client) Roles(ctx context.Context) ([]Role, error) {
+	resp, err := c.RoleList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+
+	roles := make([]Role, 0, len(resp.Roles))
+	for _, name := range resp.Roles {
+		role, err := c.RoleGet(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get role %s: %w", name, err)
+		}
+		var perms []Permission
+		for _, perm := range role.Perm {
+			perms = append(perms, newPermission(perm))
+		}
+		roles = append(roles, Role{Name: name, Permissions: perms})
+	}
+
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+// RBACConfig is the declarative representation of the cluster's users and roles. The root user
+// and role are managed through ETCD_ROOT_PASSWORD, so they're left out, although users may still
+// be granted the root role.
+type RBACConfig struct {
+	Roles []Role `yaml:"roles"`
+	Users []User `yaml:"users"`
+}
+
+// ReadRBACConfig reads and validates an RBAC config file.
+func ReadRBACConfig(path string) (*RBACConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rbac config: %w", err)
+	}
+
+	var cfg RBACConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse rbac config: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// Validate ensures names are unique, permissions are well formed and users only reference
+// roles that exist. The root role can be referenced without being defined.
+func (cfg *RBACConfig) Validate() error {
+	roles := map[string]bool{rootName: true}
+	for _, role := range cfg.Roles {
+		if role.Name == "" {
+			return fmt.Errorf("role name must not be empty")
+		}
+		if role.Name == rootName {
+			return fmt.Errorf("the root role is managed through ETCD_ROOT_PASSWORD")
+		}
+		if roles[role.Name] {
+			return fmt.Errorf("role %s is defined more than once", role.Name)
+		}
+		roles[role.Name] = true
+
+		for _, perm := range role.Permissions {
+			if perm.Key == "" {
+				return fmt.Errorf("role %s: permission key must not be empty", role.Name)
+			}
+			if _, err := ParsePermissionType(perm.Type); err != nil {
+				return fmt.Errorf("role %s: %w", role.Name, err)
+			}
+			if perm.Prefix && perm.RangeEnd != "" {
+				return fmt.Errorf("role %s: prefix and range-end are mutually exclusive", role.Name)
+			}
+		}
+	}
+
+	users := map[string]bool{}
+	for _, user := range cfg.Users {
+		if user.Name == "" {
+			return fmt.Errorf("user name must not be empty")
+		}
+		if user.Name == rootName {
+			return fmt.Errorf("the root user is managed through ETCD_ROOT_PASSWORD")
+		}
+		if users[user.Name] {
+			return fmt.Errorf("user %s is defined more than once", user.Name)
+		}
+		users[user.Name] = true
+
+		for _, role := range user.Roles {
+			if !roles[role] {
+				return fmt.Errorf("user %s: role %s is not defined", user.Name, role)
+			}
+		}
+	}
+
+	return nil
+}
+
+// RBACConfig exports the cluster's users and roles.
+func (c *Client) RBACConfig(ctx context.Context) (*RBACConfig, error) {
+	users, err := c.Users(ctx)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := c.Roles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &RBACConfig{Roles: []Role{}, Users: []User{}}
+	for _, role := range roles {
+		if role.Name != rootName {
+			cfg.Roles = append(cfg.Roles, role)
+		}
+	}
+	for _, user := range users {
+		if user.Name != rootName {
+			cfg.Users = append(cfg.Users, user)
+		}
+	}
+	return cfg, nil
+}
+
+type RBACAction string
+
+const (
+	RBACAddRole          RBACAction = "add-role"
+	RBACGrantPermission  RBACAction = "grant-permission"
+	RBACRevokePermission RBACAction = "revoke-permission"
+	RBACAddUser          RBACAction = "add-user"
+	RBACGrantRole        RBACAction = "grant-role"
+	RBACRevokeRole       RBACAction = "revoke-role"
+	RBACDeleteUser       RBACAction = "delete-user"
+	RBACDeleteRole       RBACAction = "delete-role"
+)
+
+// RBACChange is a single step required to reconcile the live auth state with the desired config.
+type RBACChange struct {
+	Action     RBACAction
+	User       string
+	Role       string
+	Permission Permission
+	// PasswordEnv names the env var holding the password of a new user.
+	PasswordEnv string
+}
+
+func (c RBACChange) String() string {
+	switch c.Action {
+	case RBACAddRole:
+		return fmt.Sprintf("+ role %s", c.Role)
+	case RBACDeleteRole:
+		return fmt.Sprintf("- role %s", c.Role)
+	case RBACGrantPermission:
+		return fmt.Sprintf("+ role %s: %s", c.Role, c.Permission)
+	case RBACRevokePermission:
+		return fmt.Sprintf("- role %s: %s", c.Role, c.Permission)
+	case RBACAddUser:
+		return fmt.Sprintf("+ user %s", c.User)
+	case RBACDeleteUser:
+		return fmt.Sprintf("- user %s", c.User)
+	case RBACGrantRole:
+		return fmt.Sprintf("+ user %s: role %s", c.User, c.Role)
+	case RBACRevokeRole:
+		return fmt.Sprintf("- user %s: role %s", c.User, c.Role)
+	}
+	return string(c.Action)
+}
+
+func (p Permission) String() string {
+	switch {
+	case p.Prefix:
+		return fmt.Sprintf("%s on prefix %q", p.Type, p.Key)
+	case p.RangeEnd != "":
+		return fmt.Sprintf("%s on range [%q, %q)", p.Type, p.Key, p.RangeEnd)
+	}
+	return fmt.Sprintf("%s on key %q", p.Type, p.Key)
+}
+
+// PlanRBAC returns the changes required to move from the current state to the desired one. Roles
+// and their permissions are created before they're granted to users, and nothing is deleted until
+// every grant has been made. The root user and role themselves are never touched.
+func PlanRBAC(current, desired *RBACConfig) []RBACChange {
+	var changes []RBACChange
+
+	currentRoles := map[string]Role{}
+	for _, role := range current.Roles {
+		currentRoles[role.Name] = role
+	}
+	desiredRoles := map[string]bool{}
+	for _, role := range desired.Roles {
+		desiredRoles[role.Name] = true
+	}
+
+	for _, role := range desired.Roles {
+		existing, ok := currentRoles[role.Name]
+		if !ok {
+			changes = append(changes, RBACChange{Action: RBACAddRole, Role: role.Name})
+		}
+
+		have := map[[2]string]Permission{}
+		for _, perm := range existing.Permissions {
+			have[permissionKey(perm)] = perm
+		}
+		want := map[[2]string]bool{}
+		for _, perm := range role.Permissions {
+			perm.Type = strings.ToLower(perm.Type)
+			want[permissionKey(perm)] = true
+			// Granting a permission on an existing key range replaces its type.
+			if cur, ok := have[permissionKey(perm)]; !ok || cur.Type != perm.Type {
+				changes = append(changes, RBACChange{Action: RBACGrantPermission, Role: role.Name, Permission: perm})
+			}
+		}
+		for _, perm := range existing.Permissions {
+			if !want[permissionKey(perm)] {
+				changes = append(changes, RBACChange{Action: RBACRevokePermission, Role: role.Name, Permission: perm})
+			}
+		}
+	}
+
+	currentUsers := map[string]User{}
+	for _, user := range current.Users {
+		currentUsers[user.Name] = user
+	}
+	desiredUsers := map[string]bool{}
+	for _, user := range desired.Users {
+		desiredUsers[user.Name] = true
+	}
+
+	var revocations []RBACChange
+	for _, user := range desired.Users {
+		existing, ok := currentUsers[user.Name]
+		if !ok {
+			changes = append(changes, RBACChange{Action: RBACAddUser, User: user.Name, PasswordEnv: user.PasswordEnv})
+		}
+
+		for _, role := range user.Roles {
+			if !slices.Contains(existing.Roles, role) {
+				changes = append(changes, RBACChange{Action: RBACGrantRole, User: user.Name, Role: role})
+			}
+		}
+		for _, role := range existing.Roles {
+			if !slices.Contains(user.Roles, role) {
+				revocations = append(revocations, RBACChange{Action: RBACRevokeRole, User: user.Name, Role: role})
+			}
+		}
+	}
+	changes = append(changes, revocations...)
+
+	for _, user := range current.Users {
+		if !desiredUsers[user.Name] && user.Name != rootName {
+			changes = append(changes, RBACChange{Action: RBACDeleteUser, User: user.Name})
+		}
+	}
+	for _, role := range current.Roles {
+		if !desiredRoles[role.Name] && role.Name != rootName {
+			changes = append(changes, RBACChange{Action: RBACDeleteRole, Role: role.Name})
+		}
+	}
+
+	return changes
+}
+
+func permissionKey(p Permission) [2]string {
+	key, rangeEnd := p.KeyRange()
+	return [2]string{key, rangeEnd}
+}
+
+// ApplyRBAC applies the changes in order. Users are created with the password found in their
+// PasswordEnv, or without a password when none is specified, in which case they can only
+// authenticate with a client certificate.
+func (c *Client) ApplyRBAC(ctx context.Context, changes []RBACChange) error {
+	for _, change := range changes {
+		var err error
+		switch change.Action {
+		case RBACAddRole:
+			_, err = c.RoleAdd(ctx, change.Role)
+		case RBACDeleteRole:
+			_, err = c.RoleDelete(ctx, change.Role)
+		case RBACGrantPermission:
+			var permType client.PermissionType
+			permType, err = ParsePermissionType(change.Permission.Type)
+			if err == nil {
+				key, rangeEnd := change.Permission.KeyRange()
+				_, err = c.RoleGrantPermission(ctx, change.Role, key, rangeEnd, permType)
+			}
+		case RBACRevokePermission:
+			key, rangeEnd := change.Permission.KeyRange()
+			_, err = c.RoleRevokePermission(ctx, change.Role, key, rangeEnd)
+		case RBACAddUser:
+			var password string
+			if change.PasswordEnv != "" {
+				password = os.Getenv(change.PasswordEnv)
+				if password == "" {
+					err = fmt.Errorf("%s is not set", change.PasswordEnv)
+					break
+				}
+			}
+			_, err = c.UserAddWithOptions(ctx, change.User, password, &client.UserAddOptions{NoPassword: password == ""})
+		case RBACDeleteUser:
+			_, err = c.UserDelete(ctx, change.User)
+		case RBACGrantRole:
+			_, err = c.UserGrantRole(ctx, change.User, change.Role)
+		case RBACRevokeRole:
+			_, err = c.UserRevokeRole(ctx, change.User, change.Role)
+		default:
+			err = fmt.Errorf("unknown action %q", change.Action)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to apply %q: %w", change, err)
+		}
+	}
+	return nil
+}
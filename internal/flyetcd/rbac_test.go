@@ -0,0 +1,177 @@
+package flyetcd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/authpb"
+)
+
+func TestNewPermission(t *testing.T) {
+	t.Run("single key", func(t *testing.T) {
+		p := newPermission(&authpb.Permission{PermType: authpb.READ, Key: []byte("/config")})
+		if p.Type != "read" || p.Key != "/config" || p.Prefix || p.RangeEnd != "" {
+			t.Errorf("unexpected permission: %+v", p)
+		}
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		p := newPermission(&authpb.Permission{PermType: authpb.READWRITE, Key: []byte("/tenants/a/"), RangeEnd: []byte("/tenants/a0")})
+		if !p.Prefix || p.RangeEnd != "" {
+			t.Errorf("expected prefix permission, got %+v", p)
+		}
+
+		key, rangeEnd := p.KeyRange()
+		if key != "/tenants/a/" || rangeEnd != "/tenants/a0" {
+			t.Errorf("expected range [/tenants/a/, /tenants/a0), got [%s, %s)", key, rangeEnd)
+		}
+	})
+
+	t.Run("range", func(t *testing.T) {
+		p := newPermission(&authpb.Permission{PermType: authpb.WRITE, Key: []byte("a"), RangeEnd: []byte("m")})
+		if p.Prefix || p.RangeEnd != "m" {
+			t.Errorf("expected range permission, got %+v", p)
+		}
+	})
+}
+
+func TestParsePermissionType(t *testing.T) {
+	for _, s := range []string{"read", "WRITE", "readwrite"} {
+		if _, err := ParsePermissionType(s); err != nil {
+			t.Errorf("expected %q to parse, got %v", s, err)
+		}
+	}
+	if _, err := ParsePermissionType("admin"); err == nil {
+		t.Error("expected error for invalid permission type")
+	}
+}
+
+func TestPlanRBAC(t *testing.T) {
+	current := &RBACConfig{
+		Roles: []Role{
+			{Name: "root"},
+			{Name: "tenant-a", Permissions: []Permission{
+				{Type: "read", Key: "/tenants/a/", Prefix: true},
+				{Type: "read", Key: "/shared"},
+			}},
+			{Name: "legacy"},
+		},
+		Users: []User{
+			{Name: "root", Roles: []string{"root"}},
+			{Name: "tenant-a", Roles: []string{"legacy", "tenant-a"}},
+			{Name: "old-tenant", Roles: []string{"legacy"}},
+			{Name: "operator", Roles: []string{"root"}},
+			{Name: "former-operator", Roles: []string{"root", "legacy"}},
+		},
+	}
+
+	desired := &RBACConfig{
+		Roles: []Role{
+			{Name: "tenant-a", Permissions: []Permission{
+				{Type: "READWRITE", Key: "/tenants/a/", Prefix: true},
+			}},
+			{Name: "tenant-b", Permissions: []Permission{
+				{Type: "readwrite", Key: "/tenants/b/", Prefix: true},
+			}},
+		},
+		Users: []User{
+			{Name: "tenant-a", Roles: []string{"tenant-a"}},
+			{Name: "tenant-b", Roles: []string{"tenant-b"}, PasswordEnv: "TENANT_B_PASSWORD"},
+			{Name: "operator", Roles: []string{"root"}},
+			{Name: "former-operator"},
+		},
+	}
+	if err := desired.Validate(); err != nil {
+		t.Fatalf("expected users to be able to reference the root role: %v", err)
+	}
+
+	var got []string
+	for _, change := range PlanRBAC(current, desired) {
+		got = append(got, change.String())
+	}
+
+	expected := []string{
+		`+ role tenant-a: readwrite on prefix "/tenants/a/"`,
+		`- role tenant-a: read on key "/shared"`,
+		`+ role tenant-b`,
+		`+ role tenant-b: readwrite on prefix "/tenants/b/"`,
+		`+ user tenant-b`,
+		`+ user tenant-b: role tenant-b`,
+		`- user tenant-a: role legacy`,
+		`- user former-operator: role root`,
+		`- user former-operator: role legacy`,
+		`- user old-tenant`,
+		`- role legacy`,
+	}
+
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d changes, got %d:\n%s", len(expected), len(got), strings.Join(got, "\n"))
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("change %d: expected %q, got %q", i, expected[i], got[i])
+		}
+	}
+
+	t.Run("no changes once applied", func(t *testing.T) {
+		applied := &RBACConfig{
+			Roles: append([]Role{{Name: "root"}}, desired.Roles...),
+			Users: append([]User{{Name: "root", Roles: []string{"root"}}}, desired.Users...),
+		}
+		applied.Roles[1].Permissions = []Permission{{Type: "readwrite", Key: "/tenants/a/", Prefix: true}}
+
+		if changes := PlanRBAC(applied, desired); len(changes) != 0 {
+			t.Errorf("expected no changes, got %v", changes)
+		}
+	})
+}
+
+func TestReadRBACConfig(t *testing.T) {
+	write := func(t *testing.T, contents string) string {
+		path := filepath.Join(t.TempDir(), "rbac.yaml")
+		if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+			t.Fatalf("failed to write rbac config: %v", err)
+		}
+		return path
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		cfg, err := ReadRBACConfig(write(t, `
+roles:
+  - name: tenant-a
+    permissions:
+      - type: readwrite
+        key: /tenants/a/
+        prefix: true
+users:
+  - name: tenant-a
+    roles: [tenant-a]
+    password-env: TENANT_A_PASSWORD
+`))
+		if err != nil {
+			t.Fatalf("ReadRBACConfig failed: %v", err)
+		}
+		if len(cfg.Roles) != 1 || len(cfg.Users) != 1 || cfg.Users[0].PasswordEnv != "TENANT_A_PASSWORD" {
+			t.Errorf("unexpected config: %+v", cfg)
+		}
+	})
+
+	invalid := map[string]string{
+		"undefined role": "users:\n  - name: a\n    roles: [missing]\n",
+		"duplicate role": "roles:\n  - name: a\n  - name: a\n",
+		"root role":      "roles:\n  - name: root\n",
+		"root user":      "users:\n  - name: root\n",
+		"bad type":       "roles:\n  - name: a\n    permissions:\n      - type: admin\n        key: /a\n",
+		"prefix and range": "roles:\n  - name: a\n    permissions:\n      - type: read\n        key: /a\n" +
+			"        prefix: true\n        range-end: /b\n",
+	}
+	for name, contents := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ReadRBACConfig(write(t, contents)); err == nil {
+				t.Error("expected validation error")
+			}
+		})
+	}
+}
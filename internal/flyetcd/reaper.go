@@ -0,0 +1,232 @@
+package flyetcd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fly-apps/fly-etcd/internal/privnet"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+const defaultReapGracePeriod = 30 * time.Minute
+
+type ReapAction string
+
+const (
+	// ReapActionPending indicates the member's machine is gone, but the grace period hasn't elapsed.
+	ReapActionPending ReapAction = "pending"
+	// ReapActionRemoved indicates the member was removed from the cluster.
+	ReapActionRemoved ReapAction = "removed"
+	// ReapActionRefused indicates the removal was refused as it would cost the cluster quorum.
+	ReapActionRefused ReapAction = "refused"
+	// ReapActionFailed indicates the removal was attempted, but failed.
+	ReapActionFailed ReapAction = "failed"
+	// ReapActionSkipped indicates the member's machine couldn't be determined, so it's left alone.
+	ReapActionSkipped ReapAction = "skipped"
+)
+
+// ReapDecision records what the reaper decided to do with a member whose machine is gone.
+type ReapDecision struct {
+	MemberID     uint64
+	MachineID    string
+	Started      bool
+	MissingSince time.Time
+	Action       ReapAction
+	Err          error
+}
+
+func (d ReapDecision) String() string {
+	if d.Action == ReapActionSkipped {
+		return fmt.Sprintf("member %x: %s, its machine could not be determined", d.MemberID, d.Action)
+	}
+
+	status := "started"
+	if !d.Started {
+		status = "unstarted"
+	}
+	msg := fmt.Sprintf("member %x (machine: %q, %s) missing since %s: %s",
+		d.MemberID, d.MachineID, status, d.MissingSince.Format(time.RFC3339), d.Action)
+	if d.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, d.Err)
+	}
+	return msg
+}
+
+// Reaper removes members whose machine no longer exists. This includes members that were added,
+// but never started because the join failed before etcd's first boot.
+type Reaper struct {
+	GracePeriod time.Duration
+
+	missingSince map[uint64]time.Time
+}
+
+func NewReaper() *Reaper {
+	return &Reaper{
+		GracePeriod:  getEnvOrDefault("ETCD_REAPER_GRACE_PERIOD", defaultReapGracePeriod),
+		missingSince: map[uint64]time.Time{},
+	}
+}
+
+// ReaperEnabled returns true if automatic member reaping has been enabled.
+func ReaperEnabled() bool {
+	return getEnvOrDefault("ETCD_REAPER_ENABLED", false)
+}
+
+// Reconcile cross-references the member list with the machines registered in DNS. At most one
+// member is removed per pass, so quorum is re-evaluated against fresh membership every time.
+func (r *Reaper) Reconcile(ctx context.Context, client *Client) ([]ReapDecision, error) {
+	machines, err := privnet.AllMachines(ctx, os.Getenv("FLY_APP_NAME"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve machines: %w", err)
+	}
+
+	alive := map[string]bool{}
+	for _, m := range machines {
+		alive[m.ID] = true
+	}
+
+	// Don't trust DNS results that don't include ourselves.
+	if !alive[os.Getenv("FLY_MACHINE_ID")] {
+		return nil, fmt.Errorf("machine discovery did not include this machine")
+	}
+
+	resp, err := client.MemberList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members: %w", err)
+	}
+
+	now := time.Now()
+	seen := map[uint64]bool{}
+
+	var (
+		decisions []ReapDecision
+		removed   bool
+	)
+	for _, member := range resp.Members {
+		seen[member.ID] = true
+
+		machineID := memberMachineID(member)
+		if alive[machineID] {
+			delete(r.missingSince, member.ID)
+			continue
+		}
+
+		// A member that can't be tied to a machine, such as one added by hand with a custom peer
+		// URL, can't be shown to be gone.
+		if machineID == "" {
+			delete(r.missingSince, member.ID)
+			decisions = append(decisions, ReapDecision{
+				MemberID: member.ID,
+				Started:  member.Name != "",
+				Action:   ReapActionSkipped,
+			})
+			continue
+		}
+
+		since, ok := r.missingSince[member.ID]
+		if !ok {
+			since = now
+			r.missingSince[member.ID] = since
+		}
+
+		decision := ReapDecision{
+			MemberID:     member.ID,
+			MachineID:    machineID,
+			Started:      member.Name != "",
+			MissingSince: since,
+			Action:       ReapActionPending,
+		}
+
+		if removed || now.Sub(since) < r.GracePeriod {
+			decisions = append(decisions, decision)
+			continue
+		}
+
+		healthy := memberHealth(ctx, client, resp.Members)
+		if !safeToRemove(resp.Members, member.ID, healthy) {
+			decision.Action = ReapActionRefused
+			decisions = append(decisions, decision)
+			continue
+		}
+
+		if _, err := client.MemberRemove(ctx, member.ID); err != nil {
+			decision.Action = ReapActionFailed
+			decision.Err = err
+			decisions = append(decisions, decision)
+			continue
+		}
+
+		decision.Action = ReapActionRemoved
+		decisions = append(decisions, decision)
+		delete(r.missingSince, member.ID)
+		removed = true
+	}
+
+	// Forget about members that are no longer registered.
+	for id := range r.missingSince {
+		if !seen[id] {
+			delete(r.missingSince, id)
+		}
+	}
+
+	return decisions, nil
+}
+
+// memberMachineID resolves the machine associated with a member. Unstarted members have no
+// name, so the machine ID is derived from the peer URL instead. Returns an empty string when
+// the machine can't be determined.
+func memberMachineID(member *etcdserverpb.Member) string {
+	if member.Name != "" {
+		return member.Name
+	}
+	for _, peerURL := range member.PeerURLs {
+		if id := machineIDFromPeerURL(peerURL); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+// memberHealth returns the set of members that respond to status requests.
+func memberHealth(ctx context.Context, client *Client, members []*etcdserverpb.Member) map[uint64]bool {
+	healthy := map[uint64]bool{}
+	for _, member := range members {
+		if len(member.ClientURLs) == 0 {
+			continue
+		}
+		sCtx, cancel := context.WithTimeout(ctx, (5 * time.Second))
+		_, err := client.Status(sCtx, member.ClientURLs[0])
+		cancel()
+		healthy[member.ID] = err == nil
+	}
+	return healthy
+}
+
+// safeToRemove reports whether the remaining healthy voting members would still form a quorum
+// once the target has been removed. Learners don't vote, so they can always be removed.
+func safeToRemove(members []*etcdserverpb.Member, target uint64, healthy map[uint64]bool) bool {
+	var voters, healthyVoters int
+	for _, member := range members {
+		if member.ID == target {
+			if member.IsLearner {
+				return true
+			}
+			continue
+		}
+		if member.IsLearner {
+			continue
+		}
+		voters++
+		if healthy[member.ID] {
+			healthyVoters++
+		}
+	}
+
+	if voters == 0 {
+		return false
+	}
+
+	return healthyVoters >= voters/2+1
+}
@@ -0,0 +1,68 @@
+package flyetcd
+
+import (
+	"testing"
+
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+)
+
+func TestSafeToRemove(t *testing.T) {
+	members := []*etcdserverpb.Member{
+		{ID: 1, Name: "a"},
+		{ID: 2, Name: "b"},
+		{ID: 3, Name: "c"},
+		{ID: 4, Name: "d", IsLearner: true},
+	}
+
+	t.Run("dead voter with healthy majority", func(t *testing.T) {
+		healthy := map[uint64]bool{1: true, 2: true}
+		if !safeToRemove(members, 3, healthy) {
+			t.Error("expected removal to be safe")
+		}
+	})
+
+	t.Run("remaining voters lack quorum", func(t *testing.T) {
+		healthy := map[uint64]bool{1: true}
+		if safeToRemove(members, 3, healthy) {
+			t.Error("expected removal to be refused")
+		}
+	})
+
+	t.Run("learners can always be removed", func(t *testing.T) {
+		if !safeToRemove(members, 4, map[uint64]bool{}) {
+			t.Error("expected learner removal to be safe")
+		}
+	})
+
+	t.Run("last voter is never removed", func(t *testing.T) {
+		single := []*etcdserverpb.Member{{ID: 1, Name: "a"}}
+		if safeToRemove(single, 1, map[uint64]bool{}) {
+			t.Error("expected removal of the last voter to be refused")
+		}
+	})
+}
+
+func TestMemberMachineID(t *testing.T) {
+	t.Setenv("FLY_APP_NAME", "test-app")
+
+	t.Run("started", func(t *testing.T) {
+		m := &etcdserverpb.Member{Name: "148e21da", PeerURLs: []string{"http://148e21da.vm.test-app.internal:2380"}}
+		if id := memberMachineID(m); id != "148e21da" {
+			t.Errorf("expected '148e21da', got %q", id)
+		}
+	})
+
+	t.Run("unstarted", func(t *testing.T) {
+		m := &etcdserverpb.Member{PeerURLs: []string{"http://9185e73f.vm.test-app.internal:2380"}}
+		if id := memberMachineID(m); id != "9185e73f" {
+			t.Errorf("expected '9185e73f', got %q", id)
+		}
+	})
+
+	t.Run("unresolvable", func(t *testing.T) {
+		m := &etcdserverpb.Member{PeerURLs: []string{"http://10.0.0.1:2380"}}
+		if id := memberMachineID(m); id != "" {
+			t.Errorf("expected an empty id, got %q", id)
+		}
+	})
+}
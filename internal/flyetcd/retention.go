@@ -0,0 +1,120 @@
+package flyetcd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+)
+
+// RetentionPolicy keeps the newest backup of each of the most recent hours, days and weeks,
+// grandfather-father-son style. Everything else is pruned.
+type RetentionPolicy struct {
+	Hourly int
+	Daily  int
+	Weekly int
+}
+
+// ResolveRetentionPolicy reads the policy from BACKUP_RETAIN_HOURLY, BACKUP_RETAIN_DAILY and
+// BACKUP_RETAIN_WEEKLY. Pruning is disabled unless at least one of them is set.
+func ResolveRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{
+		Hourly: retentionCount("BACKUP_RETAIN_HOURLY"),
+		Daily:  retentionCount("BACKUP_RETAIN_DAILY"),
+		Weekly: retentionCount("BACKUP_RETAIN_WEEKLY"),
+	}
+}
+
+func retentionCount(key string) int {
+	count := getEnvOrDefault(key, 0)
+	if count < 0 {
+		log.Printf("invalid value %d for %s, ignoring", count, key)
+		return 0
+	}
+	return count
+}
+
+// Enabled reports whether the policy prunes anything.
+func (p RetentionPolicy) Enabled() bool {
+	return p.Hourly > 0 || p.Daily > 0 || p.Weekly > 0
+}
+
+func (p RetentionPolicy) String() string {
+	return fmt.Sprintf("%d hourly, %d daily, %d weekly", p.Hourly, p.Daily, p.Weekly)
+}
+
+// SelectPrunable returns the backups the policy doesn't retain, in the order given. The
+// newest backup is always retained, and nothing is pruned when the policy is disabled.
+func SelectPrunable(backups []BackupVersion, policy RetentionPolicy) []BackupVersion {
+	if !policy.Enabled() || len(backups) == 0 {
+		return nil
+	}
+
+	// The newest backup of a period wins, so walk from newest to oldest.
+	sorted := make([]BackupVersion, len(backups))
+	copy(sorted, backups)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].LastModified.After(sorted[j].LastModified)
+	})
+
+	keep := map[string]bool{sorted[0].VersionID: true}
+	retain := func(count int, period func(BackupVersion) string) {
+		seen := make(map[string]bool)
+		for _, b := range sorted {
+			if len(seen) == count {
+				return
+			}
+			key := period(b)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			keep[b.VersionID] = true
+		}
+	}
+
+	retain(policy.Hourly, func(b BackupVersion) string {
+		return b.LastModified.UTC().Format("2006-01-02T15")
+	})
+	retain(policy.Daily, func(b BackupVersion) string {
+		return b.LastModified.UTC().Format("2006-01-02")
+	})
+	retain(policy.Weekly, func(b BackupVersion) string {
+		year, week := b.LastModified.UTC().ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	})
+
+	var prunable []BackupVersion
+	for _, b := range backups {
+		if !keep[b.VersionID] {
+			prunable = append(prunable, b)
+		}
+	}
+	return prunable
+}
+
+// PruneBackups deletes the backups the policy doesn't retain and returns them. With dryRun,
+// nothing is deleted.
+func PruneBackups(ctx context.Context, store BackupStore, policy RetentionPolicy, dryRun bool) ([]BackupVersion, error) {
+	if !policy.Enabled() {
+		return nil, nil
+	}
+
+	backups, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	prunable := SelectPrunable(backups, policy)
+	if dryRun {
+		return prunable, nil
+	}
+
+	for i, b := range prunable {
+		if err := store.Delete(ctx, b.VersionID); err != nil {
+			return prunable[:i], err
+		}
+	}
+
+	return prunable, nil
+}
@@ -0,0 +1,197 @@
+package flyetcd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// hourlyBackups returns a backup per hour going back count hours from now, newest first.
+func hourlyBackups(now time.Time, count int) []BackupVersion {
+	var backups []BackupVersion
+	for i := 0; i < count; i++ {
+		t := now.Add(-time.Duration(i) * time.Hour)
+		backups = append(backups, BackupVersion{
+			VersionID:    fmt.Sprintf("v%d", i),
+			LastModified: t,
+		})
+	}
+	return backups
+}
+
+func retainedIDs(backups, pruned []BackupVersion) map[string]bool {
+	retained := make(map[string]bool)
+	for _, b := range backups {
+		retained[b.VersionID] = true
+	}
+	for _, b := range pruned {
+		delete(retained, b.VersionID)
+	}
+	return retained
+}
+
+func TestSelectPrunable(t *testing.T) {
+	// A Wednesday, so weeks don't line up with the start of the data
+	now := time.Date(2024, time.March, 13, 12, 30, 0, 0, time.UTC)
+
+	t.Run("disabled", func(t *testing.T) {
+		backups := hourlyBackups(now, 100)
+		if pruned := SelectPrunable(backups, RetentionPolicy{}); len(pruned) != 0 {
+			t.Errorf("expected nothing to be pruned, got %d", len(pruned))
+		}
+	})
+
+	t.Run("hourly", func(t *testing.T) {
+		backups := hourlyBackups(now, 48)
+		pruned := SelectPrunable(backups, RetentionPolicy{Hourly: 24})
+
+		if len(pruned) != 24 {
+			t.Fatalf("expected 24 backups to be pruned, got %d", len(pruned))
+		}
+		retained := retainedIDs(backups, pruned)
+		for i := 0; i < 24; i++ {
+			if !retained[fmt.Sprintf("v%d", i)] {
+				t.Errorf("expected v%d to be retained", i)
+			}
+		}
+	})
+
+	t.Run("newest of each period", func(t *testing.T) {
+		// Two backups within the same hour, only the newest is retained
+		backups := []BackupVersion{
+			{VersionID: "newer", LastModified: now.Add(-10 * time.Minute)},
+			{VersionID: "older", LastModified: now.Add(-20 * time.Minute)},
+			{VersionID: "previous-hour", LastModified: now.Add(-time.Hour)},
+		}
+		pruned := SelectPrunable(backups, RetentionPolicy{Hourly: 2})
+
+		if len(pruned) != 1 || pruned[0].VersionID != "older" {
+			t.Errorf("expected only the older backup to be pruned, got %+v", pruned)
+		}
+	})
+
+	t.Run("grandfather father son", func(t *testing.T) {
+		// Six weeks of hourly backups
+		backups := hourlyBackups(now, 6*7*24)
+		policy := RetentionPolicy{Hourly: 24, Daily: 14, Weekly: 8}
+		pruned := SelectPrunable(backups, policy)
+		retained := retainedIDs(backups, pruned)
+
+		// The last 24 hours cover two days, and 14 days cover three ISO weeks. Six weeks of data
+		// starting on a Wednesday spans seven ISO weeks.
+		// 24 hourly + 12 more daily + 4 more weekly
+		if len(retained) != 24+12+4 {
+			t.Errorf("expected %d backups to be retained, got %d", 24+12+4, len(retained))
+		}
+
+		for _, b := range backups {
+			if !retained[b.VersionID] {
+				continue
+			}
+			age := now.Sub(b.LastModified)
+			if age >= 24*time.Hour && b.LastModified.Hour() != 23 {
+				t.Errorf("expected retained backup %s older than a day to be the last of its day, got %s", b.VersionID, b.LastModified)
+			}
+		}
+	})
+
+	t.Run("newest always retained", func(t *testing.T) {
+		backups := []BackupVersion{
+			{VersionID: "old", LastModified: now.Add(-72 * time.Hour)},
+			{VersionID: "new", LastModified: now},
+		}
+		pruned := SelectPrunable(backups, RetentionPolicy{Weekly: 1})
+
+		if len(pruned) != 1 || pruned[0].VersionID != "old" {
+			t.Errorf("expected the old backup to be pruned, got %+v", pruned)
+		}
+	})
+}
+
+func TestResolveRetentionPolicy(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		if policy := ResolveRetentionPolicy(); policy.Enabled() {
+			t.Errorf("expected retention to be disabled, got %s", policy)
+		}
+	})
+
+	t.Run("configured", func(t *testing.T) {
+		t.Setenv("BACKUP_RETAIN_HOURLY", "24")
+		t.Setenv("BACKUP_RETAIN_DAILY", "14")
+		t.Setenv("BACKUP_RETAIN_WEEKLY", "-1")
+
+		policy := ResolveRetentionPolicy()
+		if policy != (RetentionPolicy{Hourly: 24, Daily: 14}) {
+			t.Errorf("unexpected policy %+v", policy)
+		}
+	})
+}
+
+func TestPruneBackups(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+
+	store, err := NewFileStore(root)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+
+	// Three backups on consecutive days
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		id := backupKey(now.Add(-time.Duration(i)*24*time.Hour), int64(100-i))
+		p := filepath.Join(root, filepath.FromSlash(id))
+		if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte("snapshot"), 0600); err != nil {
+			t.Fatalf("failed to write backup: %v", err)
+		}
+		ts := now.Add(-time.Duration(i) * 24 * time.Hour)
+		if err := os.Chtimes(p, ts, ts); err != nil {
+			t.Fatalf("failed to set backup time: %v", err)
+		}
+	}
+
+	policy := RetentionPolicy{Daily: 2}
+
+	t.Run("dry run", func(t *testing.T) {
+		pruned, err := PruneBackups(ctx, store, policy, true)
+		if err != nil {
+			t.Fatalf("PruneBackups failed: %v", err)
+		}
+		if len(pruned) != 1 || pruned[0].Revision != 98 {
+			t.Fatalf("expected the oldest backup to be selected, got %+v", pruned)
+		}
+
+		versions, err := store.List(ctx)
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		if len(versions) != 3 {
+			t.Errorf("expected dry run to keep all backups, got %d", len(versions))
+		}
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		if _, err := PruneBackups(ctx, store, policy, false); err != nil {
+			t.Fatalf("PruneBackups failed: %v", err)
+		}
+
+		versions, err := store.List(ctx)
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		if len(versions) != 2 {
+			t.Fatalf("expected 2 backups to remain, got %d", len(versions))
+		}
+		for _, v := range versions {
+			if v.Revision == 98 {
+				t.Errorf("expected the oldest backup to be pruned")
+			}
+		}
+	})
+}
@@ -2,41 +2,64 @@ package flyetcd
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net/url"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
 )
 
 const (
 	defaultS3Bucket = "fly-etcd-backups"
 	S3BackupName    = "etcd-backup.db"
+
+	// S3LayoutVersioned writes every backup to the same key and relies on bucket versioning
+	// for history.
+	S3LayoutVersioned = "versioned"
+	// S3LayoutTimestamped writes every backup to its own key, <prefix>/<yyyy>/<mm>/<timestamp>-<rev>.db,
+	// for stores without versioning support.
+	S3LayoutTimestamped = "timestamped"
+
+	// s3KeyIDMetadata is the object metadata recording the key a backup was encrypted with.
+	s3KeyIDMetadata = "encryption-key-id"
+	// s3UnencryptedKeyID marks unencrypted backups, since empty metadata values aren't stored
+	// reliably by all S3-compatible stores.
+	s3UnencryptedKeyID = "none"
 )
 
+// S3Client stores backups in S3 or an S3-compatible store.
 type S3Client struct {
 	bucket string
 	prefix string
+	layout string
 
 	Client *s3.Client
 }
 
-func NewS3Client(ctx context.Context, prefix string) (*S3Client, error) {
-	cfg, err := config.LoadDefaultConfig(ctx)
+func NewS3Client(ctx context.Context, bucket, prefix string) (*S3Client, error) {
+	client, err := newS3Service(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+		return nil, err
 	}
 
 	cl := &S3Client{
-		Client: s3.NewFromConfig(cfg),
-		bucket: resolveS3Bucket(),
+		Client: client,
+		bucket: bucket,
 		prefix: prefix,
+		layout: resolveS3Layout(),
 	}
 
 	if err := cl.testS3Credentials(ctx); err != nil {
@@ -46,34 +69,88 @@ func NewS3Client(ctx context.Context, prefix string) (*S3Client, error) {
 	return cl, nil
 }
 
-func (s *S3Client) S3Path() string {
-	return fmt.Sprintf("s3://%s/%s/%s", s.bucket, s.prefix, S3BackupName)
+// newS3BackupStore opens the store for s3://<bucket>/<prefix>.
+func newS3BackupStore(ctx context.Context, u *url.URL) (BackupStore, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("s3 backup url must specify a bucket")
+	}
+	return NewS3Client(ctx, u.Host, strings.Trim(u.Path, "/"))
 }
 
-// Upload uploads the backup file to S3 and returns the version ID.
-func (s *S3Client) Upload(ctx context.Context, backupPath string) (string, error) {
-	file, err := os.Open(backupPath)
+// newS3Service builds the S3 service client. S3_ENDPOINT, S3_FORCE_PATH_STYLE and S3_CA_CERT
+// allow targeting S3-compatible stores such as Tigris or MinIO.
+func newS3Service(ctx context.Context) (*s3.Client, error) {
+	endpoint := os.Getenv("S3_ENDPOINT")
+
+	var opts []func(*config.LoadOptions) error
+	if endpoint != "" {
+		// S3-compatible stores generally don't care about the region, but requests still have
+		// to be signed with one.
+		opts = append(opts, config.WithDefaultRegion("auto"))
+	}
+	if ca := os.Getenv("S3_CA_CERT"); ca != "" {
+		opts = append(opts, config.WithCustomCABundle(strings.NewReader(ca)))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
 	if err != nil {
-		return "", fmt.Errorf("failed to open backup file: %w", err)
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
-	defer func() {
-		_ = file.Close()
-	}()
 
-	resp, err := s.Client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(filepath.Join(s.prefix, S3BackupName)),
-		Body:   file,
+	return s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if endpoint != "" {
+			o.BaseEndpoint = aws.String(endpoint)
+		}
+		o.UsePathStyle = getEnvOrDefault("S3_FORCE_PATH_STYLE", false)
+	}), nil
+}
+
+func (s *S3Client) Location() string {
+	if s.layout == S3LayoutTimestamped {
+		return fmt.Sprintf("s3://%s/%s/", s.bucket, s.prefix)
+	}
+	return fmt.Sprintf("s3://%s/%s/%s", s.bucket, s.prefix, S3BackupName)
+}
+
+// Upload streams the backup to S3 and returns its ID. With the versioned layout this is the
+// version ID, with the timestamped layout it's the key relative to the prefix. The key ID is
+// recorded in the object's metadata.
+func (s *S3Client) Upload(ctx context.Context, r io.Reader, revision int64, keyID string) (string, error) {
+	key := filepath.Join(s.prefix, S3BackupName)
+	if s.layout == S3LayoutTimestamped {
+		key = path.Join(s.prefix, backupKey(time.Now(), revision))
+	}
+
+	metadata := map[string]string{s3KeyIDMetadata: s3UnencryptedKeyID}
+	if keyID != "" {
+		metadata[s3KeyIDMetadata] = keyID
+	}
+
+	// The uploader buffers parts in memory, so the length doesn't need to be known up front.
+	resp, err := manager.NewUploader(s.Client).Upload(ctx, &s3.PutObjectInput{
+		Bucket:   aws.String(s.bucket),
+		Key:      aws.String(key),
+		Body:     r,
+		Metadata: metadata,
 	})
 	if err != nil {
 		return "", fmt.Errorf("failed to upload backup: %w", err)
 	}
 
-	return *resp.VersionId, nil
+	if s.layout == S3LayoutTimestamped {
+		return strings.TrimPrefix(key, s.prefix+"/"), nil
+	}
+
+	return aws.ToString(resp.VersionID), nil
 }
 
-// Download downloads the latest backup from S3 and returns the path to the snapshot file.
+// Download downloads the specified backup from S3 and returns the path to the snapshot file.
 func (s *S3Client) Download(ctx context.Context, directory, version string) (string, error) {
+	key, versionID, err := s.objectKey(version)
+	if err != nil {
+		return "", err
+	}
+
 	snapshotPath := filepath.Join(directory, "backup-restore.db")
 	file, err := os.Create(snapshotPath)
 	if err != nil {
@@ -83,16 +160,13 @@ func (s *S3Client) Download(ctx context.Context, directory, version string) (str
 		_ = file.Close()
 	}()
 
-	s3Key := filepath.Join(s.prefix, S3BackupName)
-	input := &s3.GetObjectInput{
-		Bucket:    &s.bucket,
-		Key:       &s3Key,
-		VersionId: &version,
-	}
-
-	result, err := s.Client.GetObject(ctx, input)
+	result, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:    aws.String(s.bucket),
+		Key:       key,
+		VersionId: versionID,
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to download from S3: %v", err)
+		return "", fmt.Errorf("failed to download from S3: %w", s3NotFound(err))
 	}
 	defer func() {
 		_ = result.Body.Close()
@@ -102,65 +176,210 @@ func (s *S3Client) Download(ctx context.Context, directory, version string) (str
 		return "", fmt.Errorf("failed to write snapshot: %v", err)
 	}
 
-	cmd := exec.Command("etcdutl", "snapshot", "status", snapshotPath, "--write-out", "table")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("snapshot verification failed: %v", err)
-	}
-
 	return snapshotPath, nil
 }
 
-type BackupVersion struct {
-	IsLatest     bool
-	VersionID    string
-	LastModified time.Time
-	Size         int64
-}
-
-func (s *S3Client) ListBackups(ctx context.Context) ([]BackupVersion, error) {
-	input := &s3.ListObjectVersionsInput{
-		Bucket:  aws.String(s.bucket),
-		Prefix:  aws.String(s.prefix),
-		MaxKeys: aws.Int32(24),
+func (s *S3Client) List(ctx context.Context) ([]BackupVersion, error) {
+	if s.layout == S3LayoutTimestamped {
+		return s.listTimestampedBackups(ctx)
 	}
 
-	result, err := s.Client.ListObjectVersions(ctx, input)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list versions: %v", err)
+	key := filepath.Join(s.prefix, S3BackupName)
+	paginator := s3.NewListObjectVersionsPaginator(s.Client, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(key),
+	})
+
+	var versions []BackupVersion
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list versions: %v", err)
+		}
+
+		for _, version := range page.Versions {
+			if *version.Key == key {
+				versions = append(versions, BackupVersion{
+					VersionID:    *version.VersionId,
+					LastModified: *version.LastModified,
+					Size:         *version.Size,
+					IsLatest:     *version.IsLatest,
+				})
+			}
+		}
 	}
 
+	// Sort by LastModified, newest first
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].LastModified.After(versions[j].LastModified)
+	})
+
+	return versions, nil
+}
+
+// listTimestampedBackups lists the backups under the prefix with plain object listing, newest first.
+func (s *S3Client) listTimestampedBackups(ctx context.Context) ([]BackupVersion, error) {
+	paginator := s3.NewListObjectsV2Paginator(s.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix + "/"),
+	})
+
 	var versions []BackupVersion
-	for _, version := range result.Versions {
-		if *version.Key == filepath.Join(s.prefix, S3BackupName) {
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backups: %v", err)
+		}
+
+		for _, obj := range page.Contents {
+			id := strings.TrimPrefix(aws.ToString(obj.Key), s.prefix+"/")
+			_, revision, ok := parseBackupKey(id)
+			if !ok {
+				continue
+			}
 			versions = append(versions, BackupVersion{
-				VersionID:    *version.VersionId,
-				LastModified: *version.LastModified,
-				Size:         *version.Size,
-				IsLatest:     *version.IsLatest,
+				VersionID:    id,
+				LastModified: aws.ToTime(obj.LastModified),
+				Size:         aws.ToInt64(obj.Size),
+				Revision:     revision,
 			})
 		}
 	}
 
-	// Sort by LastModified, newest first
+	// Keys sort chronologically, newest first
 	sort.Slice(versions, func(i, j int) bool {
-		return versions[i].LastModified.After(versions[j].LastModified)
+		return versions[i].VersionID > versions[j].VersionID
 	})
+	if len(versions) > 0 {
+		versions[0].IsLatest = true
+	}
 
 	return versions, nil
 }
 
-func (s *S3Client) LastBackupTaken(ctx context.Context) (time.Time, error) {
+func (s *S3Client) Latest(ctx context.Context) (BackupVersion, error) {
+	if s.layout == S3LayoutTimestamped {
+		versions, err := s.listTimestampedBackups(ctx)
+		if err != nil {
+			return BackupVersion{}, err
+		}
+		if len(versions) == 0 {
+			return BackupVersion{}, ErrBackupNotFound
+		}
+		return versions[0], nil
+	}
+
 	obj, err := s.Client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(filepath.Join(s.prefix, S3BackupName)),
 	})
 	if err != nil {
-		return time.Time{}, err
+		return BackupVersion{}, s3NotFound(err)
+	}
+
+	return BackupVersion{
+		IsLatest:     true,
+		VersionID:    aws.ToString(obj.VersionId),
+		LastModified: aws.ToTime(obj.LastModified),
+		Size:         aws.ToInt64(obj.ContentLength),
+	}, nil
+}
+
+func (s *S3Client) Delete(ctx context.Context, version string) error {
+	key, versionID, err := s.objectKey(version)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:    aws.String(s.bucket),
+		Key:       key,
+		VersionId: versionID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete backup %s: %w", version, err)
+	}
+
+	return nil
+}
+
+// Metadata describes the specified backup. IsLatest is not populated. The key ID is read from
+// the object's metadata, falling back to the backup's header for backups uploaded without it.
+func (s *S3Client) Metadata(ctx context.Context, version string) (BackupVersion, error) {
+	key, versionID, err := s.objectKey(version)
+	if err != nil {
+		return BackupVersion{}, err
+	}
+
+	head, err := s.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:    aws.String(s.bucket),
+		Key:       key,
+		VersionId: versionID,
+	})
+	if err != nil {
+		return BackupVersion{}, s3NotFound(err)
+	}
+
+	_, revision, _ := parseBackupKey(version)
+	if keyID, ok := head.Metadata[s3KeyIDMetadata]; ok {
+		if keyID == s3UnencryptedKeyID {
+			keyID = ""
+		}
+		return BackupVersion{
+			VersionID:    version,
+			LastModified: aws.ToTime(head.LastModified),
+			Size:         aws.ToInt64(head.ContentLength),
+			Revision:     revision,
+			KeyID:        keyID,
+		}, nil
+	}
+
+	// Fetch just enough of the object to read the encryption header, if any.
+	obj, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:    aws.String(s.bucket),
+		Key:       key,
+		VersionId: versionID,
+		Range:     aws.String(fmt.Sprintf("bytes=0-%d", envelopeHeaderMax-1)),
+	})
+	if err != nil {
+		return BackupVersion{}, s3NotFound(err)
+	}
+	defer func() {
+		_ = obj.Body.Close()
+	}()
+
+	keyID, err := readEnvelopeKeyID(obj.Body)
+	if err != nil {
+		return BackupVersion{}, err
 	}
 
-	return *obj.LastModified, nil
+	// The total size follows the slash in "bytes 0-299/12345".
+	size := aws.ToInt64(obj.ContentLength)
+	if _, total, found := strings.Cut(aws.ToString(obj.ContentRange), "/"); found {
+		if n, err := strconv.ParseInt(total, 10, 64); err == nil {
+			size = n
+		}
+	}
+
+	return BackupVersion{
+		VersionID:    version,
+		LastModified: aws.ToTime(obj.LastModified),
+		Size:         size,
+		Revision:     revision,
+		KeyID:        keyID,
+	}, nil
+}
+
+// objectKey resolves a backup ID to its object key and version ID.
+func (s *S3Client) objectKey(version string) (*string, *string, error) {
+	if s.layout == S3LayoutTimestamped {
+		if _, _, ok := parseBackupKey(version); !ok {
+			return nil, nil, fmt.Errorf("invalid backup id %q", version)
+		}
+		return aws.String(path.Join(s.prefix, version)), nil, nil
+	}
+
+	return aws.String(filepath.Join(s.prefix, S3BackupName)), aws.String(version), nil
 }
 
 func (s *S3Client) testS3Credentials(ctx context.Context) error {
@@ -176,6 +395,25 @@ func (s *S3Client) testS3Credentials(ctx context.Context) error {
 	return nil
 }
 
+// s3NotFound translates missing object errors into ErrBackupNotFound.
+func s3NotFound(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NotFound" || apiErr.ErrorCode() == "NoSuchKey" || apiErr.ErrorCode() == "NoSuchVersion") {
+		return ErrBackupNotFound
+	}
+	return err
+}
+
+func resolveS3Layout() string {
+	switch layout := getEnvOrDefault("S3_KEY_LAYOUT", S3LayoutVersioned); layout {
+	case S3LayoutVersioned, S3LayoutTimestamped:
+		return layout
+	default:
+		log.Printf("[warn] invalid S3 key layout %q, using %s", layout, S3LayoutVersioned)
+		return S3LayoutVersioned
+	}
+}
+
 func resolveS3Bucket() string {
 	if os.Getenv("S3_BUCKET") != "" {
 		return os.Getenv("S3_BUCKET")
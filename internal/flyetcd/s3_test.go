@@ -0,0 +1,81 @@
+package flyetcd
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestResolveS3Layout(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		if layout := resolveS3Layout(); layout != S3LayoutVersioned {
+			t.Errorf("expected %s, got %s", S3LayoutVersioned, layout)
+		}
+	})
+
+	t.Run("timestamped", func(t *testing.T) {
+		t.Setenv("S3_KEY_LAYOUT", "timestamped")
+		if layout := resolveS3Layout(); layout != S3LayoutTimestamped {
+			t.Errorf("expected %s, got %s", S3LayoutTimestamped, layout)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		t.Setenv("S3_KEY_LAYOUT", "flat")
+		if layout := resolveS3Layout(); layout != S3LayoutVersioned {
+			t.Errorf("expected %s, got %s", S3LayoutVersioned, layout)
+		}
+	})
+}
+
+func TestNewS3Service(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", "")
+
+	t.Run("aws", func(t *testing.T) {
+		client, err := newS3Service(context.Background())
+		if err != nil {
+			t.Fatalf("newS3Service failed: %v", err)
+		}
+
+		opts := client.Options()
+		if opts.BaseEndpoint != nil {
+			t.Errorf("expected no custom endpoint, got %q", *opts.BaseEndpoint)
+		}
+		if opts.UsePathStyle {
+			t.Error("expected virtual-hosted style addressing")
+		}
+	})
+
+	t.Run("custom endpoint", func(t *testing.T) {
+		t.Setenv("S3_ENDPOINT", "https://minio.internal:9000")
+		t.Setenv("S3_FORCE_PATH_STYLE", "true")
+		setupTestCA(t)
+		t.Setenv("S3_CA_CERT", os.Getenv("ETCD_CA_CERT"))
+
+		client, err := newS3Service(context.Background())
+		if err != nil {
+			t.Fatalf("newS3Service failed: %v", err)
+		}
+
+		opts := client.Options()
+		if opts.BaseEndpoint == nil || *opts.BaseEndpoint != "https://minio.internal:9000" {
+			t.Errorf("expected custom endpoint, got %v", opts.BaseEndpoint)
+		}
+		if !opts.UsePathStyle {
+			t.Error("expected path style addressing")
+		}
+		if opts.Region != "auto" {
+			t.Errorf("expected default region auto, got %q", opts.Region)
+		}
+	})
+
+	t.Run("invalid ca", func(t *testing.T) {
+		t.Setenv("S3_CA_CERT", "not a certificate")
+
+		if _, err := newS3Service(context.Background()); err == nil {
+			t.Error("expected an error for an invalid CA certificate")
+		}
+	})
+}
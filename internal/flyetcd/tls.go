@@ -0,0 +1,418 @@
+package flyetcd
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const defaultCertValidity = 90 * 24 * time.Hour
+
+// SecurityConfig mirrors etcd's transport security settings.
+type SecurityConfig struct {
+	CertFile       string `yaml:"cert-file,omitempty"`
+	KeyFile        string `yaml:"key-file,omitempty"`
+	TrustedCAFile  string `yaml:"trusted-ca-file,omitempty"`
+	ClientCertAuth bool   `yaml:"client-cert-auth,omitempty"`
+}
+
+// PeerTLSEnabled returns true if peer traffic should be encrypted with certificates issued by
+// the cluster CA.
+func PeerTLSEnabled() bool {
+	return getEnvOrDefault("ETCD_PEER_TLS", false) && caConfigured()
+}
+
+func caConfigured() bool {
+	return os.Getenv("ETCD_CA_CERT") != "" && os.Getenv("ETCD_CA_KEY") != ""
+}
+
+func peerScheme() string {
+	if PeerTLSEnabled() {
+		return "https"
+	}
+	return "http"
+}
+
+// ClientTLSEnabled returns true if clients should connect over TLS using certificates issued by
+// the cluster CA.
+func ClientTLSEnabled() bool {
+	return getEnvOrDefault("ETCD_CLIENT_TLS", false) && caConfigured()
+}
+
+func clientScheme() string {
+	if ClientTLSEnabled() {
+		return "https"
+	}
+	return "http"
+}
+
+func certsDir() string {
+	return filepath.Join(DataDir, "certs")
+}
+
+// writeCA creates the cert directory and writes the CA certificate into it.
+func writeCA(ca *certificateAuthority) (string, error) {
+	if err := os.MkdirAll(certsDir(), 0700); err != nil {
+		return "", fmt.Errorf("failed to create cert directory: %w", err)
+	}
+
+	caPath := filepath.Join(certsDir(), "ca.crt")
+	if err := writeFileAtomic(caPath, ca.certPEM, 0644); err != nil {
+		return "", fmt.Errorf("failed to write ca certificate: %w", err)
+	}
+	return caPath, nil
+}
+
+// SetPeerTLS issues a peer certificate for this machine from the cluster CA. Peer certificates
+// are used both to serve and to dial peers, so they're valid for server and client auth.
+//
+// The peer URLs are left untouched, as members that joined over http keep advertising http
+// until they're migrated. Peers still need the certificates to dial members that have already
+// been migrated to https.
+func (c *Config) SetPeerTLS(endpoint *Endpoint) error {
+	if !PeerTLSEnabled() {
+		return nil
+	}
+
+	ca, err := loadCA()
+	if err != nil {
+		return err
+	}
+
+	caPath, err := writeCA(ca)
+	if err != nil {
+		return err
+	}
+
+	certPath := filepath.Join(certsDir(), "peer.crt")
+	keyPath := filepath.Join(certsDir(), "peer.key")
+	usages := []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	if err := ca.issueToFiles(endpoint.Addr, []string{endpoint.Addr}, privateIPs(), usages, certPath, keyPath); err != nil {
+		return fmt.Errorf("failed to issue peer certificate: %w", err)
+	}
+
+	c.PeerTransportSecurity = SecurityConfig{
+		CertFile:       certPath,
+		KeyFile:        keyPath,
+		TrustedCAFile:  caPath,
+		ClientCertAuth: true,
+	}
+
+	return nil
+}
+
+// SetClientTLS issues this machine's server certificate from the cluster CA, along with a client
+// certificate used by local tooling. The server certificate covers every address clients may
+// use to reach the member, including the app's flycast address.
+func (c *Config) SetClientTLS(endpoint *Endpoint) error {
+	if !ClientTLSEnabled() {
+		c.ClientTransportSecurity = SecurityConfig{}
+		return nil
+	}
+
+	ca, err := loadCA()
+	if err != nil {
+		return err
+	}
+
+	caPath, err := writeCA(ca)
+	if err != nil {
+		return err
+	}
+
+	appName := os.Getenv("FLY_APP_NAME")
+	dnsNames := []string{
+		endpoint.Addr,
+		fmt.Sprintf("%s.internal", appName),
+		fmt.Sprintf("%s.flycast", appName),
+		"localhost",
+	}
+	ips := append(privateIPs(), net.IPv4(127, 0, 0, 1), net.IPv6loopback)
+
+	certPath := filepath.Join(certsDir(), "server.crt")
+	keyPath := filepath.Join(certsDir(), "server.key")
+	usages := []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	if err := ca.issueToFiles(endpoint.Addr, dnsNames, ips, usages, certPath, keyPath); err != nil {
+		return fmt.Errorf("failed to issue server certificate: %w", err)
+	}
+
+	// Local tooling connects as root.
+	usages = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	clientCertPath := filepath.Join(certsDir(), "client.crt")
+	clientKeyPath := filepath.Join(certsDir(), "client.key")
+	if err := ca.issueToFiles("root", nil, nil, usages, clientCertPath, clientKeyPath); err != nil {
+		return fmt.Errorf("failed to issue client certificate: %w", err)
+	}
+
+	c.ClientTransportSecurity = SecurityConfig{
+		CertFile:       certPath,
+		KeyFile:        keyPath,
+		TrustedCAFile:  caPath,
+		ClientCertAuth: getEnvOrDefault("ETCD_CLIENT_CERT_AUTH", false),
+	}
+
+	return nil
+}
+
+// IssueClientCertificate issues a client certificate for the specified common name from the
+// cluster CA. When auth is enabled, etcd authenticates the certificate as the user of the same name.
+func IssueClientCertificate(commonName string, validity time.Duration) (certPEM []byte, keyPEM []byte, err error) {
+	ca, err := loadCA()
+	if err != nil {
+		return nil, nil, err
+	}
+	return ca.issue(commonName, nil, nil, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, validity)
+}
+
+// clientTLSConfig returns the TLS configuration used to connect to etcd, or nil when client TLS
+// is disabled. The client certificate is read from the ETCD_CLIENT_CERT and ETCD_CLIENT_KEY
+// secrets when set, otherwise from the certificate issued to local tooling.
+func clientTLSConfig() (*tls.Config, error) {
+	if !ClientTLSEnabled() {
+		return nil, nil
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM([]byte(os.Getenv("ETCD_CA_CERT"))) {
+		return nil, fmt.Errorf("failed to parse ETCD_CA_CERT")
+	}
+
+	config := &tls.Config{
+		RootCAs:    roots,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	certPEM, keyPEM := os.Getenv("ETCD_CLIENT_CERT"), os.Getenv("ETCD_CLIENT_KEY")
+	if certPEM != "" && keyPEM != "" {
+		cert, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+		return config, nil
+	}
+
+	certPath := filepath.Join(certsDir(), "client.crt")
+	keyPath := filepath.Join(certsDir(), "client.key")
+	if _, err := os.Stat(certPath); err != nil {
+		// The certificate is issued on boot, so it may not exist yet.
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, err
+	}
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load client certificate: %w", err)
+	}
+	config.Certificates = []tls.Certificate{cert}
+
+	return config, nil
+}
+
+// PeerMigrationResult describes a member whose peer URLs were switched over to https.
+type PeerMigrationResult struct {
+	MemberID uint64 `json:"member_id"`
+	PeerURL  string `json:"peer_url"`
+}
+
+// MigratePeerURLs switches the peer listener and advertised peer URL over to https.
+func (c *Config) MigratePeerURLs(endpoint *Endpoint) {
+	c.ListenPeerUrls = fmt.Sprintf("%s://[::]:2380", peerScheme())
+	c.InitialAdvertisePeerUrls = endpoint.PeerURL
+}
+
+// MigratePeerTLS moves this member's peer URLs over to https. The new config is written and read
+// back before the member is updated, so etcd can't be restarted into a config that doesn't match
+// its membership. If updating the member or restarting etcd fails, both are rolled back.
+func (n *Node) MigratePeerTLS(ctx context.Context, client *Client, restart func() error) (*PeerMigrationResult, error) {
+	resp, err := client.MemberList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members: %w", err)
+	}
+	member := findMember(resp.Members, n.Endpoint)
+	if member == nil {
+		return nil, &MemberNotFoundError{Err: fmt.Errorf("no member found with matching machine id: %q", n.MachineID)}
+	}
+
+	previous, err := os.ReadFile(ConfigFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	restoreConfig := func() {
+		if err := writeFileAtomic(ConfigFilePath, previous, 0700); err != nil {
+			log.Printf("[error] failed to restore %s: %v", ConfigFilePath, err)
+		}
+	}
+
+	n.Config.MigratePeerURLs(n.Endpoint)
+	if err := WriteConfig(n.Config); err != nil {
+		restoreConfig()
+		return nil, fmt.Errorf("failed to write config: %w", err)
+	}
+	if err := verifyPeerURLs(n.Endpoint); err != nil {
+		restoreConfig()
+		return nil, err
+	}
+
+	if _, err := client.MemberUpdate(ctx, member.ID, []string{n.Endpoint.PeerURL}); err != nil {
+		restoreConfig()
+		return nil, fmt.Errorf("failed to update member %x: %w", member.ID, err)
+	}
+
+	if err := restart(); err != nil {
+		if _, rollbackErr := client.MemberUpdate(ctx, member.ID, member.PeerURLs); rollbackErr != nil {
+			log.Printf("[error] failed to restore peer urls %v of member %x: %v", member.PeerURLs, member.ID, rollbackErr)
+		}
+		restoreConfig()
+		return nil, fmt.Errorf("failed to restart etcd: %w", err)
+	}
+
+	return &PeerMigrationResult{MemberID: member.ID, PeerURL: n.Endpoint.PeerURL}, nil
+}
+
+// verifyPeerURLs reads the config back the way etcd will be started with it, and ensures it
+// serves and advertises the endpoint's peer URL.
+func verifyPeerURLs(endpoint *Endpoint) error {
+	cfg, err := resolveConfig()
+	if err != nil {
+		return fmt.Errorf("failed to verify config: %w", err)
+	}
+	if cfg.InitialAdvertisePeerUrls != endpoint.PeerURL {
+		return fmt.Errorf("config advertises peer urls %q, expected %q", cfg.InitialAdvertisePeerUrls, endpoint.PeerURL)
+	}
+	if !urlsHaveScheme(cfg.ListenPeerUrls, peerScheme()) {
+		return fmt.Errorf("config listens for peers on %q, expected %s", cfg.ListenPeerUrls, peerScheme())
+	}
+	return nil
+}
+
+type certificateAuthority struct {
+	cert    *x509.Certificate
+	certPEM []byte
+	key     crypto.Signer
+}
+
+// loadCA parses the cluster CA stored within the ETCD_CA_CERT and ETCD_CA_KEY secrets.
+func loadCA() (*certificateAuthority, error) {
+	certPEM := []byte(os.Getenv("ETCD_CA_CERT"))
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode ETCD_CA_CERT")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ETCD_CA_CERT: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("ETCD_CA_CERT is not a CA certificate")
+	}
+
+	key, err := parsePrivateKey([]byte(os.Getenv("ETCD_CA_KEY")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ETCD_CA_KEY: %w", err)
+	}
+
+	return &certificateAuthority{cert: cert, certPEM: certPEM, key: key}, nil
+}
+
+// issue signs a new certificate and returns it along with its private key.
+func (ca *certificateAuthority) issue(commonName string, dnsNames []string, ips []net.IP, usages []x509.ExtKeyUsage, validity time.Duration) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   commonName,
+			Organization: []string{os.Getenv("FLY_APP_NAME")},
+		},
+		DNSNames:    dnsNames,
+		IPAddresses: ips,
+		NotBefore:   now.Add(-5 * time.Minute),
+		NotAfter:    now.Add(validity),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: usages,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// issueToFiles issues a new certificate and writes it, along with its private key, to the specified paths.
+func (ca *certificateAuthority) issueToFiles(commonName string, dnsNames []string, ips []net.IP, usages []x509.ExtKeyUsage, certPath, keyPath string) error {
+	certPEM, keyPEM, err := ca.issue(commonName, dnsNames, ips, usages, defaultCertValidity)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(keyPath, keyPEM, 0600); err != nil {
+		return err
+	}
+	return writeFileAtomic(certPath, certPEM, 0644)
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unsupported private key format %q", block.Type)
+}
+
+// privateIPs returns the machine's 6PN address, if known.
+func privateIPs() []net.IP {
+	ip := net.ParseIP(os.Getenv("FLY_PRIVATE_IP"))
+	if ip == nil {
+		return nil
+	}
+	return []net.IP{ip}
+}
@@ -0,0 +1,319 @@
+package flyetcd
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// setupTestCA generates a throwaway CA and exposes it through the ETCD_CA_* secrets.
+func setupTestCA(t *testing.T) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("failed to create CA certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal CA key: %v", err)
+	}
+
+	t.Setenv("ETCD_CA_CERT", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	t.Setenv("ETCD_CA_KEY", string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})))
+}
+
+func readTestCert(t *testing.T, path string) *x509.Certificate {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read certificate: %v", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("no PEM data found in %s", path)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return cert
+}
+
+func TestSetPeerTLS(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		setupTestDirs(t)
+		setupTestCA(t)
+
+		config, err := NewConfig()
+		if err != nil {
+			t.Fatalf("NewConfig failed: %v", err)
+		}
+		if err := config.SetPeerTLS(NewEndpoint("")); err != nil {
+			t.Fatalf("SetPeerTLS failed: %v", err)
+		}
+		if config.PeerTransportSecurity.CertFile != "" {
+			t.Errorf("expected no peer certificate, got %q", config.PeerTransportSecurity.CertFile)
+		}
+	})
+
+	t.Run("issues peer certificate", func(t *testing.T) {
+		setupTestDirs(t)
+		setupTestCA(t)
+		t.Setenv("ETCD_PEER_TLS", "true")
+		t.Setenv("FLY_PRIVATE_IP", "fdaa:0:1:a7b:1::2")
+
+		endpoint := NewEndpoint("")
+		config, err := NewConfig()
+		if err != nil {
+			t.Fatalf("NewConfig failed: %v", err)
+		}
+		if err := config.SetPeerTLS(endpoint); err != nil {
+			t.Fatalf("SetPeerTLS failed: %v", err)
+		}
+
+		security := config.PeerTransportSecurity
+		if !security.ClientCertAuth {
+			t.Error("expected client cert auth to be enabled")
+		}
+
+		cert := readTestCert(t, security.CertFile)
+		if len(cert.DNSNames) != 1 || cert.DNSNames[0] != endpoint.Addr {
+			t.Errorf("expected DNS names [%s], got %v", endpoint.Addr, cert.DNSNames)
+		}
+		if len(cert.IPAddresses) != 1 || cert.IPAddresses[0].String() != "fdaa:0:1:a7b:1::2" {
+			t.Errorf("expected private IP SAN, got %v", cert.IPAddresses)
+		}
+
+		ca := readTestCert(t, security.TrustedCAFile)
+		roots := x509.NewCertPool()
+		roots.AddCert(ca)
+		for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+			if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{usage}}); err != nil {
+				t.Errorf("expected certificate to verify for usage %v: %v", usage, err)
+			}
+		}
+
+		info, err := os.Stat(security.KeyFile)
+		if err != nil {
+			t.Fatalf("failed to stat key: %v", err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("expected key permissions 0600, got %o", info.Mode().Perm())
+		}
+
+		if filepath.Dir(security.CertFile) != certsDir() {
+			t.Errorf("expected certificate within %s, got %s", certsDir(), security.CertFile)
+		}
+	})
+
+	t.Run("new members advertise https", func(t *testing.T) {
+		setupTestDirs(t)
+		setupTestCA(t)
+		t.Setenv("ETCD_PEER_TLS", "true")
+
+		endpoint := NewEndpoint("")
+		if endpoint.PeerURL != "https://test-machine.vm.test-app.internal:2380" {
+			t.Errorf("expected https peer url, got %q", endpoint.PeerURL)
+		}
+	})
+}
+
+func TestSetClientTLS(t *testing.T) {
+	t.Run("issues server and client certificates", func(t *testing.T) {
+		setupTestDirs(t)
+		setupTestCA(t)
+		t.Setenv("ETCD_CLIENT_TLS", "true")
+		t.Setenv("ETCD_CLIENT_CERT_AUTH", "true")
+
+		endpoint := NewEndpoint("")
+		config, err := NewConfig()
+		if err != nil {
+			t.Fatalf("NewConfig failed: %v", err)
+		}
+		if err := config.SetClientTLS(endpoint); err != nil {
+			t.Fatalf("SetClientTLS failed: %v", err)
+		}
+
+		if !config.ClientTransportSecurity.ClientCertAuth {
+			t.Error("expected client cert auth to be enabled")
+		}
+		if config.ListenClientUrls != "https://[::]:2379" {
+			t.Errorf("expected https listener, got %q", config.ListenClientUrls)
+		}
+
+		server := readTestCert(t, config.ClientTransportSecurity.CertFile)
+		for _, name := range []string{endpoint.Addr, "test-app.internal", "test-app.flycast", "localhost"} {
+			if err := server.VerifyHostname(name); err != nil {
+				t.Errorf("expected server certificate to be valid for %s: %v", name, err)
+			}
+		}
+
+		tlsConfig, err := clientTLSConfig()
+		if err != nil {
+			t.Fatalf("clientTLSConfig failed: %v", err)
+		}
+		if len(tlsConfig.Certificates) != 1 {
+			t.Fatalf("expected the local client certificate to be loaded, got %d", len(tlsConfig.Certificates))
+		}
+		client, err := x509.ParseCertificate(tlsConfig.Certificates[0].Certificate[0])
+		if err != nil {
+			t.Fatalf("failed to parse client certificate: %v", err)
+		}
+		if client.Subject.CommonName != "root" {
+			t.Errorf("expected client certificate for root, got %q", client.Subject.CommonName)
+		}
+	})
+
+	t.Run("plaintext kept during migration", func(t *testing.T) {
+		setupTestDirs(t)
+		setupTestCA(t)
+		t.Setenv("ETCD_CLIENT_TLS", "true")
+		t.Setenv("ETCD_CLIENT_PLAINTEXT", "true")
+
+		if got := listenClientURLs(); got != "https://[::]:2379,http://[::]:2379" {
+			t.Errorf("expected https and http listeners, got %q", got)
+		}
+	})
+
+	t.Run("disabling clears the settings", func(t *testing.T) {
+		setupTestDirs(t)
+
+		config, err := NewConfig()
+		if err != nil {
+			t.Fatalf("NewConfig failed: %v", err)
+		}
+		config.ClientTransportSecurity.CertFile = "/data/certs/server.crt"
+		if err := config.SetClientTLS(NewEndpoint("")); err != nil {
+			t.Fatalf("SetClientTLS failed: %v", err)
+		}
+		if config.ClientTransportSecurity.CertFile != "" {
+			t.Errorf("expected client transport security to be cleared, got %+v", config.ClientTransportSecurity)
+		}
+
+		tlsConfig, err := clientTLSConfig()
+		if err != nil {
+			t.Fatalf("clientTLSConfig failed: %v", err)
+		}
+		if tlsConfig != nil {
+			t.Error("expected no tls config when client TLS is disabled")
+		}
+	})
+}
+
+func TestMigratePeerTLS(t *testing.T) {
+	setupTestDirs(t)
+	endpoint := startTestEtcd(t)
+
+	client, err := newClient([]string{endpoint}, nil)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), (30 * time.Second))
+	defer cancel()
+
+	peerURLs := func() []string {
+		t.Helper()
+		resp, err := client.MemberList(ctx)
+		if err != nil {
+			t.Fatalf("failed to list members: %v", err)
+		}
+		return resp.Members[0].PeerURLs
+	}
+	original := peerURLs()
+
+	// The member and config are written over plain http, then peer TLS is enabled.
+	newNode := func() *Node {
+		t.Helper()
+		node := &Node{MachineID: "test-machine", Endpoint: NewEndpoint("test-machine"), Config: DefaultConfig()}
+		if err := WriteConfig(node.Config); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		return node
+	}
+	setupTestCA(t)
+	t.Setenv("ETCD_PEER_TLS", "true")
+
+	t.Run("restart failure rolls back", func(t *testing.T) {
+		node := newNode()
+		before, err := os.ReadFile(ConfigFilePath)
+		if err != nil {
+			t.Fatalf("failed to read config: %v", err)
+		}
+
+		_, err = node.MigratePeerTLS(ctx, client, func() error {
+			if urls := peerURLs(); len(urls) != 1 || urls[0] != node.Endpoint.PeerURL {
+				t.Errorf("expected the member to be updated before the restart, got %v", urls)
+			}
+			return errors.New("supervisor unavailable")
+		})
+		if err == nil {
+			t.Fatal("expected the migration to fail")
+		}
+
+		if urls := peerURLs(); !slices.Equal(urls, original) {
+			t.Errorf("expected peer urls to be restored to %v, got %v", original, urls)
+		}
+		after, err := os.ReadFile(ConfigFilePath)
+		if err != nil {
+			t.Fatalf("failed to read config: %v", err)
+		}
+		if string(after) != string(before) {
+			t.Error("expected the config to be restored")
+		}
+	})
+
+	t.Run("success", func(t *testing.T) {
+		node := newNode()
+		restarted := false
+		result, err := node.MigratePeerTLS(ctx, client, func() error {
+			restarted = true
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("MigratePeerTLS failed: %v", err)
+		}
+		if !restarted {
+			t.Error("expected etcd to be restarted")
+		}
+		if result.PeerURL != "https://test-machine.vm.test-app.internal:2380" {
+			t.Errorf("unexpected peer url %q", result.PeerURL)
+		}
+		if urls := peerURLs(); len(urls) != 1 || urls[0] != result.PeerURL {
+			t.Errorf("expected the member to advertise %s, got %v", result.PeerURL, urls)
+		}
+		if err := verifyPeerURLs(node.Endpoint); err != nil {
+			t.Errorf("expected the config to be migrated: %v", err)
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
@@ -23,6 +24,9 @@ type process struct {
 	dir string
 	env []string
 	cmd *exec.Cmd
+
+	stopped          atomic.Bool
+	restartRequested atomic.Bool
 }
 
 type Opt func(*process)
@@ -109,6 +113,18 @@ func (p *process) Interrupt() {
 	}
 }
 
+// Stop interrupts the process and prevents it from being restarted.
+func (p *process) Stop() {
+	p.stopped.Store(true)
+	p.Interrupt()
+}
+
+// Restart interrupts the process and starts it again once it has exited.
+func (p *process) Restart() {
+	p.restartRequested.Store(true)
+	p.Interrupt()
+}
+
 func (p *process) Kill() {
 	if p.Running() {
 		p.writeLine([]byte("\033[1mKilling...\033[0m"))
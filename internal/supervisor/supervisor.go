@@ -28,6 +28,8 @@ type Supervisor struct {
 	procs   []*process
 	stop    chan struct{}
 	timeout time.Duration
+
+	beforeStop []func()
 }
 
 func New(name string, timeout time.Duration) *Supervisor {
@@ -81,6 +83,18 @@ func (*Supervisor) runProcess(ctx context.Context, proc *process) error {
 			return nil
 		}
 
+		// process restart was requested, run it again right away
+		if proc.restartRequested.Swap(false) {
+			proc.writeLine([]byte("restarting"))
+			continue
+		}
+
+		// process was stopped individually, exit
+		if proc.stopped.Load() {
+			proc.writeLine([]byte("stopped"))
+			return nil
+		}
+
 		// process is done, exit
 		if !proc.restart {
 			proc.writeLine([]byte("done"))
@@ -154,6 +168,12 @@ func (h *Supervisor) Stop() {
 	h.stop <- struct{}{}
 }
 
+// BeforeStop registers a function that is run before the processes are interrupted when
+// stopping on a signal. Functions are run in the order they were registered.
+func (h *Supervisor) BeforeStop(fn func()) {
+	h.beforeStop = append(h.beforeStop, fn)
+}
+
 func (h *Supervisor) StopOnSignal(sigs ...os.Signal) {
 	sigch := make(chan os.Signal, 1)
 	signal.Notify(sigch, sigs...)
@@ -161,7 +181,56 @@ func (h *Supervisor) StopOnSignal(sigs ...os.Signal) {
 	go func() {
 		for sig := range sigch {
 			log.Printf("Got %s, stopping\n", sig)
+			for _, fn := range h.beforeStop {
+				fn()
+			}
 			h.Stop()
 		}
 	}()
 }
+
+// StopProcessOnSignal stops the named process when the signal is received, while the
+// supervisor and its other processes keep running.
+func (h *Supervisor) StopProcessOnSignal(name string, sig os.Signal) {
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, sig)
+
+	go func() {
+		for range sigch {
+			proc := h.process(name)
+			if proc == nil {
+				log.Printf("Got %s, but no process named %s exists\n", sig, name)
+				continue
+			}
+			log.Printf("Got %s, stopping %s\n", sig, name)
+			proc.Stop()
+		}
+	}()
+}
+
+// RestartProcessOnSignal restarts the named process when the signal is received.
+func (h *Supervisor) RestartProcessOnSignal(name string, sig os.Signal) {
+	sigch := make(chan os.Signal, 1)
+	signal.Notify(sigch, sig)
+
+	go func() {
+		for range sigch {
+			proc := h.process(name)
+			if proc == nil {
+				log.Printf("Got %s, but no process named %s exists\n", sig, name)
+				continue
+			}
+			log.Printf("Got %s, restarting %s\n", sig, name)
+			proc.Restart()
+		}
+	}()
+}
+
+func (h *Supervisor) process(name string) *process {
+	for _, proc := range h.procs {
+		if proc.name == name {
+			return proc
+		}
+	}
+	return nil
+}